@@ -0,0 +1,258 @@
+// Package clock provides a replaceable time source, the system clock, a
+// clock corrected by an offset and a fake clock for tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer fires once like time.Timer. Stop and Reset drain the channel, a
+// value received after them belongs to the new expiration.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// System is the clock of the operating system.
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) NewTimer(d time.Duration) Timer         { return &systemTimer{time.NewTimer(d)} }
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *systemTimer) Stop() bool {
+
+	if t.timer.Stop() {
+		return true
+	}
+
+	select {
+	case <-t.timer.C:
+	default:
+	}
+
+	return false
+}
+
+func (t *systemTimer) Reset(d time.Duration) bool {
+	active := t.Stop()
+	t.timer.Reset(d)
+	return active
+}
+
+// Corrected adds an offset to a base clock, the offset is usually measured
+// against ntp servers. Durations are not affected by the offset.
+type Corrected struct {
+	offset int64 // first field, 64-bit aligned for atomic access
+	base   Clock
+}
+
+// NewCorrected returns a clock based on base, nil uses the system clock.
+func NewCorrected(base Clock) *Corrected {
+
+	if base == nil {
+		base = System
+	}
+
+	return &Corrected{base: base}
+}
+
+// SetOffset sets the offset added to the base clock.
+func (c *Corrected) SetOffset(offset time.Duration) {
+	atomic.StoreInt64(&c.offset, int64(offset))
+}
+
+func (c *Corrected) Offset() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.offset))
+}
+
+func (c *Corrected) Now() time.Time {
+	return c.base.Now().Add(c.Offset())
+}
+
+func (c *Corrected) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *Corrected) After(d time.Duration) <-chan time.Time {
+	return c.base.After(d)
+}
+
+func (c *Corrected) NewTimer(d time.Duration) Timer {
+	return c.base.NewTimer(d)
+}
+
+// Fake is a clock which only moves when it is told to.
+type Fake struct {
+	now    time.Time
+	timers []*fakeTimer
+	mu     sync.Mutex
+}
+
+type fakeTimer struct {
+	clock *Fake
+	at    time.Time
+	ch    chan time.Time
+}
+
+// NewFake returns a fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel which receives the time when the clock has been
+// advanced by d.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer returns a timer which fires when the clock has been advanced
+// by d.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{clock: f, ch: make(chan time.Time, 1)}
+	f.start(t, d)
+
+	return t
+}
+
+// start must be called with the lock held.
+func (f *Fake) start(t *fakeTimer, d time.Duration) {
+
+	if d <= 0 {
+		t.ch <- f.now
+		return
+	}
+
+	t.at = f.now.Add(d)
+	f.timers = append(f.timers, t)
+}
+
+// stop removes the timer and drains its channel, the lock must be held.
+func (f *Fake) stop(t *fakeTimer) bool {
+
+	select {
+	case <-t.ch:
+	default:
+	}
+
+	for i := range f.timers {
+		if f.timers[i] == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+func (t *fakeTimer) Stop() bool {
+
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	return t.clock.stop(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	active := t.clock.stop(t)
+	t.clock.start(t, d)
+
+	return active
+}
+
+// Advance moves the clock forward and fires the expired timers.
+func (f *Fake) Advance(d time.Duration) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(f.now.Add(d))
+}
+
+// Set sets the clock and fires the expired timers, in the order of their
+// expiration.
+func (f *Fake) Set(now time.Time) {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.set(now)
+}
+
+// set must be called with the lock held.
+func (f *Fake) set(now time.Time) {
+
+	f.now = now
+
+	sort.SliceStable(f.timers, func(i, j int) bool {
+		return f.timers[i].at.Before(f.timers[j].at)
+	})
+
+	pending := f.timers[:0]
+
+	for _, t := range f.timers {
+		if t.at.After(now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.ch <- now
+	}
+
+	f.timers = pending
+}
+
+// Timers returns the number of pending timers, tests use it to wait until
+// a goroutine is blocked on After.
+func (f *Fake) Timers() int {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.timers)
+}
@@ -0,0 +1,227 @@
+package logger
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// OverflowPolicy defines what happens to a message if the queue of the
+// asynchronous writer is full.
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait until the queue has space
+	OverflowDropNewest                       // drop the message
+	OverflowDropOldest                       // drop the oldest queued message
+)
+
+// AsyncConfig configures the asynchronous writer.
+type AsyncConfig struct {
+	QueueSize      int            // defaults to 4096 messages
+	Overflow       OverflowPolicy // defaults to OverflowBlock
+	ReportInterval time.Duration  // interval to log the dropped messages, defaults to 10s
+}
+
+type asyncItem struct {
+	level zerolog.Level
+	data  []byte
+}
+
+type asyncWriter struct {
+	queued  uint64 // first fields, 64-bit aligned for atomic access
+	dropped uint64
+
+	processed uint64
+	reported  uint64
+	config    AsyncConfig
+	queue     chan asyncItem
+	closed    bool
+	mu        sync.RWMutex
+	cond      *sync.Cond
+	condMu    sync.Mutex
+	quit      chan struct{}
+	stopped   chan struct{}
+}
+
+var (
+	dropped uint64
+)
+
+// EnableAsync decouples logging from writing the outputs, the messages are
+// queued and written by a background goroutine. An already running
+// asynchronous writer is closed first.
+func EnableAsync(config AsyncConfig) {
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = 4096
+	}
+
+	if config.ReportInterval <= 0 {
+		config.ReportInterval = 10 * time.Second
+	}
+
+	a := &asyncWriter{
+		config:  config,
+		queue:   make(chan asyncItem, config.QueueSize),
+		quit:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.condMu)
+
+	go a.run()
+
+	prev := outputs.setAsync(a)
+	if prev != nil {
+		prev.close()
+	}
+}
+
+// Close flushes all pending messages and stops the asynchronous writer,
+// messages are written synchronously afterwards.
+func Close() {
+
+	Flush()
+
+	if a := outputs.setAsync(nil); a != nil {
+		a.close()
+	}
+}
+
+// Dropped returns the number of messages dropped by the asynchronous writer.
+func Dropped() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+func (a *asyncWriter) write(lvl zerolog.Level, p []byte) (int, error) {
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return outputs.writeAll(lvl, p)
+	}
+
+	// zerolog reuses the buffer after the write
+	item := asyncItem{level: lvl, data: make([]byte, len(p))}
+	copy(item.data, p)
+
+	atomic.AddUint64(&a.queued, 1)
+
+	switch a.config.Overflow {
+
+	case OverflowDropNewest:
+		select {
+		case a.queue <- item:
+		default:
+			a.drop()
+		}
+
+	case OverflowDropOldest:
+		for {
+			select {
+			case a.queue <- item:
+				return len(p), nil
+			default:
+			}
+			select {
+			case <-a.queue:
+				a.drop()
+			default:
+			}
+		}
+
+	default:
+		a.queue <- item
+	}
+
+	return len(p), nil
+}
+
+func (a *asyncWriter) drop() {
+	atomic.AddUint64(&a.dropped, 1)
+	atomic.AddUint64(&dropped, 1)
+	a.done()
+}
+
+func (a *asyncWriter) done() {
+	a.condMu.Lock()
+	a.processed++
+	a.condMu.Unlock()
+	a.cond.Broadcast()
+}
+
+// flush waits until all messages queued before the call are written.
+func (a *asyncWriter) flush() {
+
+	target := atomic.LoadUint64(&a.queued)
+
+	a.condMu.Lock()
+	for a.processed < target {
+		a.cond.Wait()
+	}
+	a.condMu.Unlock()
+}
+
+func (a *asyncWriter) close() {
+
+	// wait for the writes in progress, later ones are written synchronously
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+
+	close(a.quit)
+	<-a.stopped
+}
+
+func (a *asyncWriter) run() {
+
+	defer close(a.stopped)
+
+	ticker := time.NewTicker(a.config.ReportInterval)
+	defer ticker.Stop()
+
+	for {
+
+		select {
+
+		case item := <-a.queue:
+			outputs.writeAll(item.level, item.data)
+			a.done()
+
+		case <-ticker.C:
+			a.report()
+
+		case <-a.quit:
+			for {
+				select {
+				case item := <-a.queue:
+					outputs.writeAll(item.level, item.data)
+					a.done()
+				default:
+					a.report()
+					return
+				}
+			}
+		}
+	}
+}
+
+// report logs the number of messages dropped since the last report.
+func (a *asyncWriter) report() {
+
+	dropped := atomic.LoadUint64(&a.dropped)
+	if dropped == a.reported {
+		return
+	}
+
+	count := dropped - a.reported
+	a.reported = dropped
+
+	direct.Warn().
+		Str(ComponentFieldName, "logger").
+		Uint64("dropped", count).
+		Msgf("log queue overflow, dropped %d messages", count)
+}
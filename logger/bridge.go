@@ -0,0 +1,253 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxLine limits the buffered bytes of an incomplete line written to a
+// Writer, longer lines are logged in parts.
+const maxLine = 64 * 1024
+
+// NewSlogHandler returns a slog.Handler which writes the records through the
+// named logger, an empty name uses the default logger. Fields attached to
+// the context of a record are added to the message.
+func NewSlogHandler(name string) slog.Handler {
+	return &slogHandler{logger: &Logger{name: name}}
+}
+
+type slogHandler struct {
+	logger *Logger
+	prefix string
+}
+
+func (h *slogHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return enabled(h.logger.name, fromSlogLevel(lvl))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+
+	fields := append([]Field(nil), ContextFields(ctx)...)
+
+	r.Attrs(func(attr slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, attr)
+		return true
+	})
+
+	var caller string
+	if r.PC != 0 {
+		frames := runtime.CallersFrames([]uintptr{r.PC})
+		frame, _ := frames.Next()
+		caller = frame.File + ":" + strconv.Itoa(frame.Line)
+	}
+
+	h.logger.write(fromSlogLevel(r.Level), caller, r.Message, fields...)
+
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+
+	var fields []Field
+	for _, attr := range attrs {
+		fields = appendAttr(fields, h.prefix, attr)
+	}
+
+	return &slogHandler{
+		logger: h.logger.With(fields...).(*Logger),
+		prefix: h.prefix,
+	}
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+
+	if len(name) == 0 {
+		return h
+	}
+
+	return &slogHandler{
+		logger: h.logger,
+		prefix: h.prefix + name + ".",
+	}
+}
+
+// appendAttr appends the attribute as field, groups are flattened to
+// dotted field names.
+func appendAttr(fields []Field, prefix string, attr slog.Attr) []Field {
+
+	value := attr.Value.Resolve()
+
+	if value.Kind() == slog.KindGroup {
+
+		group := prefix
+		if len(attr.Key) > 0 {
+			group += attr.Key + "."
+		}
+
+		for _, a := range value.Group() {
+			fields = appendAttr(fields, group, a)
+		}
+
+		return fields
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return fields
+	}
+
+	return append(fields, Field{Key: prefix + attr.Key, Value: value.Any()})
+}
+
+func fromSlogLevel(lvl slog.Level) Level {
+
+	switch {
+	case lvl < slog.LevelInfo:
+		return DebugLevel
+	case lvl < slog.LevelWarn:
+		return InfoLevel
+	case lvl < slog.LevelError:
+		return WarnLevel
+	}
+
+	return ErrorLevel
+}
+
+// NewStdLogger returns a *log.Logger which writes through the named logger,
+// the level of a message is detected from its text.
+func NewStdLogger(name string, lvl Level) *log.Logger {
+	return log.New(NewWriter(name, lvl), "", 0)
+}
+
+// NewWriter returns an io.Writer which logs every written line with the
+// named logger. The level is detected from the text of a line, lines
+// without a recognizable level are logged with lvl.
+func NewWriter(name string, lvl Level) io.Writer {
+	return &lineWriter{
+		logger: &Logger{name: name},
+		level:  lvl,
+	}
+}
+
+type lineWriter struct {
+	logger *Logger
+	level  Level
+	buf    []byte
+	mu     sync.Mutex
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+
+	for {
+
+		offset := bytes.IndexByte(w.buf, '\n')
+		if offset < 0 {
+			break
+		}
+
+		w.writeLine(w.buf[:offset])
+		w.buf = w.buf[offset+1:]
+	}
+
+	if len(w.buf) >= maxLine {
+		w.writeLine(w.buf)
+		w.buf = nil
+	}
+
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+
+	return len(p), nil
+}
+
+func (w *lineWriter) writeLine(line []byte) {
+
+	msg := strings.TrimRight(string(line), "\r")
+	if len(strings.TrimSpace(msg)) == 0 {
+		return
+	}
+
+	lvl := detectLevel(msg, w.level)
+
+	if enabled(w.logger.name, lvl) {
+		w.logger.write(lvl, "", msg)
+	}
+}
+
+// detectLevel looks for a level token at the start of the line like
+// "[ERROR]", "warn:", "INFO" or "level=debug", leading timestamps are
+// skipped. Level names in the text are ignored, "0 errors found" is not an
+// error.
+func detectLevel(line string, def Level) Level {
+
+	words := strings.Fields(line)
+	if len(words) > 4 {
+		words = words[:4]
+	}
+
+	for _, word := range words {
+
+		// timestamps like "2024/07/21" or "15:56:49.278492"
+		if word[0] >= '0' && word[0] <= '9' {
+			continue
+		}
+
+		// logfmt timestamps and callers of log.Lshortfile
+		if strings.HasPrefix(word, "time=") || strings.HasPrefix(word, "ts=") || strings.Contains(word, ".go:") {
+			continue
+		}
+
+		if lvl, ok := levelToken(word); ok {
+			return lvl
+		}
+
+		break
+	}
+
+	return def
+}
+
+// levelToken returns the level of a marked level name, a bare lower case
+// word is text.
+func levelToken(word string) (Level, bool) {
+
+	name := word
+
+	switch {
+	case strings.HasPrefix(word, "level="):
+		name = word[len("level="):]
+	case strings.HasPrefix(word, "lvl="):
+		name = word[len("lvl="):]
+	case strings.IndexByte("[(<", word[0]) >= 0:
+		name = strings.Trim(word, "[]()<>:|")
+	case strings.HasSuffix(word, ":"), strings.HasSuffix(word, "|"):
+		name = strings.TrimRight(word, ":|")
+	case word != strings.ToUpper(word):
+		return NoLevel, false
+	}
+
+	switch strings.ToLower(strings.Trim(name, `"`)) {
+	case "trace", "debug", "dbg":
+		return DebugLevel, true
+	case "info", "inf", "notice":
+		return InfoLevel, true
+	case "warn", "warning", "wrn":
+		return WarnLevel, true
+	case "error", "err", "erro", "fatal", "ftl", "panic", "crit", "critical":
+		return ErrorLevel, true
+	}
+
+	return NoLevel, false
+}
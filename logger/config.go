@@ -0,0 +1,261 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pelletier/go-toml"
+	"github.com/rs/zerolog"
+)
+
+// Config holds the configuration of the logger package. It can be read
+// from a TOML section like this:
+//
+//	[logger]
+//	level = "info"
+//	dedup = "10s"
+//
+//	[logger.components]
+//	watcher = "warn"
+//	mail = "debug"
+//
+//	[logger.sampling.error]
+//	first = 100
+//	thereafter = 1000
+//	interval = "1s"
+//
+//	[logger.redact]
+//	fields = ["password", "token", "secret", "key"]
+//	patterns = ["bearer", "card", "sk_live_[0-9a-zA-Z]+"]
+//
+//	[logger.sinks.console]
+//	type = "console"
+//	level = "info"
+//
+//	[logger.sinks.errors]
+//	type = "file"
+//	path = "/var/log/app/errors.json"
+//	level = "error"
+type Config struct {
+	Level      string                `toml:"level"`
+	Components map[string]string     `toml:"components"`
+	Sampling   map[string]Sampling   `toml:"sampling"`
+	Dedup      time.Duration         `toml:"dedup"`
+	Sinks      map[string]SinkConfig `toml:"sinks"`
+	Redact     *Redaction            `toml:"redact"`
+}
+
+// SinkConfig configures a sink, the type is one of "console" (stderr),
+// "stdout", "file", "syslog" or "journal". The format defaults to console
+// for console and stdout, to JSON for files. Components restricts the sink
+// to messages of the named loggers.
+type SinkConfig struct {
+	Type       string   `toml:"type"`
+	Level      string   `toml:"level"`
+	Format     string   `toml:"format"`
+	Components []string `toml:"components"`
+	Path       string   `toml:"path"`
+	Network    string   `toml:"network"`
+	Addr       string   `toml:"addr"`
+	Facility   int      `toml:"facility"`
+}
+
+var (
+	configGuard sync.Mutex
+	configSinks = make(map[string]bool)
+)
+
+// Configure applies the config, component levels not in the config are removed.
+// Without a redact section the current redaction is kept.
+func Configure(cfg Config) error {
+
+	def := zerolog.DebugLevel
+	if len(cfg.Level) > 0 {
+		parsed, err := ParseLevel(cfg.Level)
+		if err != nil {
+			return err
+		}
+		def = parsed
+	}
+
+	components := make(map[string]zerolog.Level, len(cfg.Components))
+	for name, lvl := range cfg.Components {
+		parsed, err := ParseLevel(lvl)
+		if err != nil {
+			return fmt.Errorf("component %s: %v", name, err)
+		}
+		components[name] = parsed
+	}
+
+	sampling := make(map[Level]Sampling, len(cfg.Sampling))
+	for name, s := range cfg.Sampling {
+		parsed, err := ParseLevel(name)
+		if err != nil {
+			return fmt.Errorf("sampling %s: %v", name, err)
+		}
+		sampling[parsed] = s
+	}
+
+	red := getRedactor()
+	if cfg.Redact != nil {
+		var err error
+		if red, err = newRedactor(*cfg.Redact); err != nil {
+			return err
+		}
+	}
+
+	sinks := make(map[string]Sink, len(cfg.Sinks))
+	for name, sc := range cfg.Sinks {
+		sink, err := openSink(sc)
+		if err != nil {
+			for _, s := range sinks {
+				closeWriter(s.Writer)
+			}
+			return fmt.Errorf("sink %s: %v", name, err)
+		}
+		sinks[name] = sink
+	}
+
+	levelGuard.Lock()
+	level = def
+	levels = components
+	levelGuard.Unlock()
+
+	for _, lvl := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel, FatalLevel, PanicLevel} {
+		SetSampling(lvl, sampling[lvl])
+	}
+
+	SetDedup(cfg.Dedup)
+
+	redactGuard.Lock()
+	redact = red
+	redactGuard.Unlock()
+
+	configureSinks(sinks)
+
+	return nil
+}
+
+// configureSinks replaces the sinks added by a previous config.
+func configureSinks(sinks map[string]Sink) {
+
+	configGuard.Lock()
+	defer configGuard.Unlock()
+
+	for name := range configSinks {
+		if _, exist := sinks[name]; !exist {
+			RemoveSink(name)
+		}
+	}
+
+	configSinks = make(map[string]bool, len(sinks))
+
+	for name, sink := range sinks {
+		AddSink(name, sink)
+		configSinks[name] = true
+	}
+}
+
+func openSink(cfg SinkConfig) (Sink, error) {
+
+	sink := Sink{
+		Level:  DebugLevel,
+		Format: Format(strings.ToLower(cfg.Format)),
+	}
+
+	if len(cfg.Level) > 0 {
+		parsed, err := ParseLevel(cfg.Level)
+		if err != nil {
+			return sink, err
+		}
+		sink.Level = parsed
+	}
+
+	switch sink.Format {
+	case "", FormatJSON, FormatConsole:
+	default:
+		return sink, fmt.Errorf("unknown format '%s'", cfg.Format)
+	}
+
+	if len(cfg.Components) > 0 {
+		components := make(map[string]bool, len(cfg.Components))
+		for _, name := range cfg.Components {
+			components[name] = true
+		}
+		sink.Filter = func(e Entry) bool {
+			return components[e.Component]
+		}
+	}
+
+	var err error
+
+	switch strings.ToLower(cfg.Type) {
+
+	case "", "console", "stderr":
+		sink.Writer = os.Stderr
+		if len(sink.Format) == 0 {
+			sink.Format = FormatConsole
+		}
+
+	case "stdout":
+		sink.Writer = os.Stdout
+		if len(sink.Format) == 0 {
+			sink.Format = FormatConsole
+		}
+
+	case "file":
+		if len(cfg.Path) == 0 {
+			return sink, fmt.Errorf("path missing")
+		}
+		sink.Writer, err = os.OpenFile(cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+
+	case "syslog":
+		sink.Format = FormatJSON
+		sink.Writer, err = NewSyslog(SyslogConfig{
+			Network:  cfg.Network,
+			Addr:     cfg.Addr,
+			Facility: cfg.Facility,
+		})
+
+	case "journal", "journald":
+		sink.Format = FormatJSON
+		sink.Writer, err = NewJournal(JournalConfig{Addr: cfg.Addr})
+
+	default:
+		return sink, fmt.Errorf("unknown type '%s'", cfg.Type)
+	}
+
+	if len(sink.Format) == 0 {
+		sink.Format = FormatJSON
+	}
+
+	return sink, err
+}
+
+// ReadConfig reads the config from a section of a TOML file, an empty section
+// name reads the config from the top level of the file.
+func ReadConfig(path string, section string) error {
+
+	tml, err := toml.LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if len(section) > 0 {
+		tree, ok := tml.Get(section).(*toml.Tree)
+		if !ok {
+			return fmt.Errorf("section %s not found in %s", section, path)
+		}
+		tml = tree
+	}
+
+	cfg := Config{}
+	if err := tml.Unmarshal(&cfg); err != nil {
+		return err
+	}
+
+	return Configure(cfg)
+}
@@ -2,6 +2,7 @@ package logger
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -56,12 +57,12 @@ func colorize(s interface{}, c string, disabled bool) string {
 	return fmt.Sprintf("%s%v%s", c, s, end)
 }
 
-func getConsoleWriter() zerolog.ConsoleWriter {
+func newConsoleWriter(out io.Writer, noColor bool) zerolog.ConsoleWriter {
 
 	output := zerolog.ConsoleWriter{
 		TimeFormat: timeFormat,
 		NoColor:    noColor,
-		Out:        os.Stderr,
+		Out:        out,
 		PartsOrder: []string{
 			zerolog.TimestampFieldName,
 			zerolog.LevelFieldName,
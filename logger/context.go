@@ -0,0 +1,75 @@
+package logger
+
+import (
+	"context"
+)
+
+// field names of the context fields
+var (
+	RequestIDFieldName = "request_id"
+	PluginFieldName    = "plugin"
+	MessageIDFieldName = "message_id"
+)
+
+type contextKey struct{}
+
+// RequestID returns a field with the id of a request.
+func RequestID(id string) Field {
+	return Field{Key: RequestIDFieldName, Value: id}
+}
+
+// Plugin returns a field with the name of a plugin.
+func Plugin(name string) Field {
+	return Field{Key: PluginFieldName, Value: name}
+}
+
+// MessageID returns a field with the id of a dispatched message.
+func MessageID(id string) Field {
+	return Field{Key: MessageIDFieldName, Value: id}
+}
+
+// WithContext returns a copy of ctx which carries the fields in addition
+// to the fields already attached to ctx, fields with the same key are replaced.
+func WithContext(ctx context.Context, fields ...Field) context.Context {
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	prev := ContextFields(ctx)
+	merged := make([]Field, 0, len(prev)+len(fields))
+
+	for i := range prev {
+		replaced := false
+		for j := range fields {
+			if fields[j].Key == prev[i].Key {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, prev[i])
+		}
+	}
+
+	merged = append(merged, fields...)
+
+	return context.WithValue(ctx, contextKey{}, merged)
+}
+
+// ContextFields returns the fields attached to ctx.
+func ContextFields(ctx context.Context) []Field {
+
+	if ctx == nil {
+		return nil
+	}
+
+	fields, _ := ctx.Value(contextKey{}).([]Field)
+	return fields
+}
+
+// FromContext returns a logger which adds the fields attached to ctx to
+// every message.
+func FromContext(ctx context.Context) SimpleLogger {
+	return l.With(ContextFields(ctx)...)
+}
@@ -0,0 +1,83 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Entry is a decoded log message.
+type Entry struct {
+	Time      time.Time
+	Level     Level
+	Message   string
+	Caller    string
+	Component string
+	Fields    map[string]interface{}
+}
+
+// DecodeEntry decodes a JSON encoded message as written to the outputs.
+func DecodeEntry(p []byte) (Entry, error) {
+
+	var evt map[string]interface{}
+
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&evt); err != nil {
+		return Entry{}, fmt.Errorf("cannot decode entry: %s", err)
+	}
+
+	entry := Entry{
+		Level:  zerolog.NoLevel,
+		Fields: make(map[string]interface{}, len(evt)),
+	}
+
+	for key, value := range evt {
+
+		s, _ := value.(string)
+
+		switch key {
+		case zerolog.TimestampFieldName:
+			entry.Time, _ = time.Parse(zerolog.TimeFieldFormat, s)
+		case zerolog.LevelFieldName:
+			entry.Level, _ = zerolog.ParseLevel(s)
+		case zerolog.MessageFieldName:
+			entry.Message = s
+		case zerolog.CallerFieldName:
+			entry.Caller = s
+		case ComponentFieldName:
+			entry.Component = s
+		default:
+			entry.Fields[key] = value
+		}
+	}
+
+	return entry, nil
+}
+
+// fieldString returns the value of a decoded field as plain string.
+func fieldString(v interface{}) string {
+
+	switch vv := v.(type) {
+	case string:
+		return vv
+	case json.Number:
+		return vv.String()
+	case nil:
+		return ""
+	case bool:
+		if vv {
+			return "true"
+		}
+		return "false"
+	}
+
+	if data, err := json.Marshal(v); err == nil {
+		return string(data)
+	}
+
+	return fmt.Sprintf("%v", v)
+}
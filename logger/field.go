@@ -0,0 +1,59 @@
+package logger
+
+import (
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Field is a typed key/value pair attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a field with a string value.
+func String(key string, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Int returns a field with an integer value.
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration returns a field with a duration value.
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Any returns a field with an arbitrary value, structs, maps and slices are
+// encoded as JSON. Sensitive struct fields can be tagged with `log:"redact"`.
+func Any(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err returns a field with the error stored under the "error" key.
+func Err(err error) Field {
+	return Field{Key: zerolog.ErrorFieldName, Value: err}
+}
+
+func (f Field) apply(e *zerolog.Event) *zerolog.Event {
+
+	switch v := f.Value.(type) {
+	case string:
+		return e.Str(f.Key, v)
+	case int:
+		return e.Int(f.Key, v)
+	case time.Duration:
+		return e.Dur(f.Key, v)
+	case time.Time:
+		return e.Time(f.Key, v)
+	case error:
+		return e.AnErr(f.Key, v)
+	case nil:
+		return e
+	default:
+		return e.Interface(f.Key, v)
+	}
+}
@@ -0,0 +1,358 @@
+package logger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+	"github.com/rs/zerolog"
+)
+
+// maxRepeated limits the number of distinct messages tracked by the
+// duplicate suppression, further messages are logged unchanged.
+const maxRepeated = 4096
+
+// Sampling limits the messages of a level, per interval the first messages
+// are logged, after that only every thereafter message. Messages are
+// counted per component and message text.
+type Sampling struct {
+	First      int           `toml:"first"`
+	Thereafter int           `toml:"thereafter"`
+	Interval   time.Duration `toml:"interval"`
+}
+
+type sampler struct {
+	Sampling
+	start  time.Time
+	counts map[string]int
+}
+
+type repeated struct {
+	logger *Logger
+	level  Level
+	msg    string
+	first  time.Time
+	count  int
+}
+
+type filter struct {
+	clock     clock.Clock
+	samplers  map[Level]*sampler
+	window    time.Duration
+	next      time.Time
+	scheduled time.Time     // expiration the timer waits for
+	timer     clock.Timer   // nil until a message is tracked
+	stop      chan struct{} // stops the goroutine of the timer
+	repeated  map[string]*repeated
+	mu        sync.Mutex
+}
+
+var (
+	filters = &filter{
+		clock:    clock.System,
+		samplers: make(map[Level]*sampler),
+		repeated: make(map[string]*repeated),
+	}
+)
+
+// SetClock sets the clock used for timestamps, sampling and duplicate
+// suppression, nil restores the system clock.
+func SetClock(c clock.Clock) {
+
+	if c == nil {
+		c = clock.System
+	}
+
+	filters.mu.Lock()
+	if filters.timer != nil {
+		filters.timer.Stop()
+		close(filters.stop)
+		filters.timer = nil
+	}
+	filters.clock = c
+	filters.scheduled = time.Time{}
+	filters.schedule()
+	filters.mu.Unlock()
+
+	timestamps.Store(clockHolder{c})
+}
+
+// clockHolder keeps the type stored in timestamps constant.
+type clockHolder struct {
+	clock.Clock
+}
+
+var timestamps atomic.Value
+
+func init() {
+	timestamps.Store(clockHolder{clock.System})
+}
+
+// timestamp returns the time of the clock set by SetClock.
+func timestamp() time.Time {
+	return timestamps.Load().(clockHolder).Now()
+}
+
+// timestampHook adds the timestamp of the clock set by SetClock, unlike
+// zerolog.TimestampFunc it only affects the loggers of this package.
+var timestampHook = zerolog.HookFunc(func(e *zerolog.Event, _ zerolog.Level, _ string) {
+	e.Time(zerolog.TimestampFieldName, timestamp())
+})
+
+// SetSampling enables sampling for the level, a zero Sampling disables it.
+func SetSampling(lvl Level, s Sampling) {
+
+	filters.mu.Lock()
+	defer filters.mu.Unlock()
+
+	if s.First <= 0 && s.Thereafter <= 0 {
+		delete(filters.samplers, lvl)
+		return
+	}
+
+	if s.Interval <= 0 {
+		s.Interval = time.Second
+	}
+
+	filters.samplers[lvl] = &sampler{Sampling: s}
+}
+
+// SetDedup enables the duplicate suppression, repeated messages within the
+// window are dropped and summarized by a "message repeated X times"
+// message when the window is over. Messages are repeated if component,
+// level, text and the fields added by With are the same. A zero window
+// disables it.
+func SetDedup(window time.Duration) {
+
+	var pending []*repeated
+
+	filters.mu.Lock()
+	if window <= 0 {
+		pending = filters.expired(time.Time{}, true)
+	}
+	filters.window = window
+	filters.mu.Unlock()
+
+	emitRepeated(pending)
+}
+
+// Flush logs the summaries of all suppressed duplicates and waits until
+// the asynchronous writer has written all queued messages.
+func Flush() {
+
+	filters.mu.Lock()
+	pending := filters.expired(time.Time{}, true)
+	filters.mu.Unlock()
+
+	emitRepeated(pending)
+
+	outputs.flush()
+}
+
+// allow reports if the message has to be logged.
+func (f *filter) allow(l *Logger, lvl Level, msg string) bool {
+
+	if atomic.LoadInt32(&outputs.unfiltered) > 0 {
+		return true
+	}
+
+	f.mu.Lock()
+
+	if f.window <= 0 && len(f.samplers) == 0 {
+		f.mu.Unlock()
+		return true
+	}
+
+	now := f.clock.Now()
+	key := l.name + "\x00" + msg
+	allowed := true
+
+	var pending []*repeated
+
+	if f.window > 0 {
+
+		pending = f.expired(now, false)
+
+		dedupKey := lvl.String() + "\x00" + key + fieldsKey(l.fields)
+
+		if r, exist := f.repeated[dedupKey]; exist {
+			r.count++
+			allowed = false
+		} else if len(f.repeated) < maxRepeated {
+			f.repeated[dedupKey] = &repeated{
+				logger: l,
+				level:  lvl,
+				msg:    msg,
+				first:  now,
+			}
+			if f.next.IsZero() || now.Add(f.window).Before(f.next) {
+				f.next = now.Add(f.window)
+			}
+			f.schedule()
+		}
+
+	}
+
+	if s, exist := f.samplers[lvl]; exist && allowed {
+		allowed = s.allow(now, key)
+	}
+
+	f.mu.Unlock()
+
+	emitRepeated(pending)
+
+	return allowed
+}
+
+// expired removes the tracked messages whose window is over and returns
+// the ones with suppressed duplicates, all if force is set.
+func (f *filter) expired(now time.Time, force bool) []*repeated {
+
+	if !force && (f.next.IsZero() || now.Before(f.next)) {
+		return nil
+	}
+
+	var pending []*repeated
+	var next time.Time
+
+	for key, r := range f.repeated {
+
+		end := r.first.Add(f.window)
+
+		if force || !now.Before(end) {
+			if r.count > 0 {
+				pending = append(pending, r)
+			}
+			delete(f.repeated, key)
+			continue
+		}
+
+		if next.IsZero() || end.Before(next) {
+			next = end
+		}
+	}
+
+	f.next = next
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].first.Before(pending[j].first)
+	})
+
+	return pending
+}
+
+// schedule sets the timer which logs the summaries when the next window
+// is over, even if no further message is logged. The lock must be held.
+func (f *filter) schedule() {
+
+	if f.next.IsZero() || (!f.scheduled.IsZero() && !f.next.Before(f.scheduled)) {
+		return
+	}
+
+	f.scheduled = f.next
+
+	d := f.next.Sub(f.clock.Now())
+
+	if f.timer != nil {
+		f.timer.Reset(d)
+		return
+	}
+
+	f.timer = f.clock.NewTimer(d)
+	f.stop = make(chan struct{})
+
+	go f.run(f.timer, f.stop)
+}
+
+// run logs the expired summaries whenever the timer fires, until SetClock
+// replaces the timer.
+func (f *filter) run(timer clock.Timer, stop chan struct{}) {
+
+	for {
+
+		select {
+		case <-stop:
+			return
+		case <-timer.C():
+		}
+
+		f.mu.Lock()
+
+		if f.timer != timer {
+			f.mu.Unlock()
+			return
+		}
+
+		f.scheduled = time.Time{}
+		pending := f.expired(f.clock.Now(), false)
+		f.schedule()
+
+		f.mu.Unlock()
+
+		emitRepeated(pending)
+	}
+}
+
+// fieldsKey distinguishes the messages of loggers with different fields.
+func fieldsKey(fields []Field) string {
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+
+	for _, field := range fields {
+		fmt.Fprintf(&b, "\x00%s=%v", field.Key, field.Value)
+	}
+
+	return b.String()
+}
+
+func (s *sampler) allow(now time.Time, key string) bool {
+
+	if s.counts == nil || now.Sub(s.start) >= s.Interval || now.Before(s.start) {
+		s.start = now
+		s.counts = make(map[string]int)
+	}
+
+	n := s.counts[key] + 1
+	s.counts[key] = n
+
+	if n <= s.First {
+		return true
+	}
+
+	if s.Thereafter <= 0 {
+		return false
+	}
+
+	return (n-s.First)%s.Thereafter == 0
+}
+
+func emitRepeated(pending []*repeated) {
+
+	red := getRedactor()
+
+	for _, r := range pending {
+
+		e := logger.WithLevel(r.level)
+		if e == nil {
+			continue
+		}
+
+		if len(r.logger.name) > 0 {
+			e = e.Str(ComponentFieldName, r.logger.name)
+		}
+
+		for i := range r.logger.fields {
+			e = red.field(r.logger.fields[i]).apply(e)
+		}
+
+		e.Int("repeated", r.count).Msgf("message repeated %d times: %s", r.count, r.msg)
+	}
+}
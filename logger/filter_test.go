@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+)
+
+// lockedBuffer is written by the timer of the duplicate suppression.
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor waits until the buffer contains s.
+func waitFor(t *testing.T, b *lockedBuffer, s string) {
+
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for !strings.Contains(b.String(), s) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q not logged, got:\n%s", s, b.String())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDedupTimer(t *testing.T) {
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+
+	var out lockedBuffer
+
+	release := Capture(&out)
+	defer release()
+
+	SetClock(fake)
+	defer SetClock(nil)
+
+	SetDedup(5 * time.Second)
+	defer SetDedup(0)
+
+	for i := 0; i < 4; i++ {
+		Error("connect db failed")
+	}
+
+	fake.Advance(4 * time.Second)
+	Error("connect db failed")
+
+	if strings.Contains(out.String(), "repeated") {
+		t.Fatalf("summary logged before the window is over:\n%s", out.String())
+	}
+
+	// no further message, the timer logs the summary
+	fake.Advance(time.Second)
+	waitFor(t, &out, "message repeated 4 times: connect db failed")
+
+	if n := strings.Count(out.String(), "\n"); n != 2 {
+		t.Fatalf("got %d messages, want the message and its summary:\n%s", n, out.String())
+	}
+
+	// the message is tracked again after the window
+	Error("connect db failed")
+	Error("connect db failed")
+
+	fake.Advance(5 * time.Second)
+	waitFor(t, &out, "message repeated 1 times: connect db failed")
+}
+
+func TestDedupTimerEarliestWindow(t *testing.T) {
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+
+	var out lockedBuffer
+
+	release := Capture(&out)
+	defer release()
+
+	SetClock(fake)
+	defer SetClock(nil)
+
+	SetDedup(5 * time.Second)
+	defer SetDedup(0)
+
+	Warn("first")
+	Warn("first")
+
+	fake.Advance(3 * time.Second)
+
+	Warn("second")
+	Warn("second")
+
+	fake.Advance(2 * time.Second)
+	waitFor(t, &out, "message repeated 1 times: first")
+
+	if strings.Contains(out.String(), "repeated 1 times: second") {
+		t.Fatalf("summary of the later window logged too early:\n%s", out.String())
+	}
+
+	fake.Advance(3 * time.Second)
+	waitFor(t, &out, "message repeated 1 times: second")
+}
+
+func TestDedupFields(t *testing.T) {
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+
+	var out lockedBuffer
+
+	release := Capture(&out)
+	defer release()
+
+	SetClock(fake)
+	defer SetClock(nil)
+
+	SetDedup(5 * time.Second)
+	defer SetDedup(0)
+
+	for i := 0; i < 3; i++ {
+		With(String("host", "db1")).Error("connect failed")
+		With(String("host", "db2")).Error("connect failed")
+	}
+
+	if n := strings.Count(out.String(), "connect failed"); n != 2 {
+		t.Fatalf("got %d messages, want one per host:\n%s", n, out.String())
+	}
+
+	fake.Advance(5 * time.Second)
+
+	waitFor(t, &out, `"host":"db1","repeated":2`)
+	waitFor(t, &out, `"host":"db2","repeated":2`)
+}
+
+func TestDedupSingleTimer(t *testing.T) {
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+
+	var out lockedBuffer
+
+	release := Capture(&out)
+	defer release()
+
+	SetClock(fake)
+	defer SetClock(nil)
+
+	SetDedup(5 * time.Second)
+	defer SetDedup(0)
+
+	// every message ends its window earlier, the timer is reset
+	for i := 0; i < 100; i++ {
+		fake.Set(fake.Now().Add(-time.Second))
+		Error("message " + strconv.Itoa(i))
+	}
+
+	if n := fake.Timers(); n != 1 {
+		t.Fatalf("got %d timers, want 1", n)
+	}
+}
+
+func TestSampling(t *testing.T) {
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+
+	var out lockedBuffer
+
+	release := Capture(&out)
+	defer release()
+
+	SetClock(fake)
+	defer SetClock(nil)
+
+	SetSampling(InfoLevel, Sampling{First: 2, Thereafter: 3, Interval: time.Second})
+	defer SetSampling(InfoLevel, Sampling{})
+
+	for i := 0; i < 10; i++ {
+		Info("tick")
+	}
+
+	// 1, 2, 5 and 8
+	if n := strings.Count(out.String(), "tick"); n != 4 {
+		t.Fatalf("got %d messages, want 4", n)
+	}
+
+	fake.Advance(time.Second)
+	Info("tick")
+
+	if n := strings.Count(out.String(), "tick"); n != 5 {
+		t.Fatalf("got %d messages after the interval, want 5", n)
+	}
+}
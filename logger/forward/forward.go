@@ -0,0 +1,173 @@
+// Package forward dispatches log messages as plugin manager messages, so
+// plugins can react to errors logged anywhere in the process.
+//
+//	forward.Enable(forward.Config{Level: logger.ErrorLevel})
+//
+//	p.RegisterActionCallback(forward.DefaultAction, func(v interface{}) error {
+//		msg := v.(forward.Message)
+//		return alert(msg.Message)
+//	})
+//
+// The messages are rate limited. Messages logged by this package or with
+// the context of a forwarded message are never forwarded. Plugins log with
+// logger.FromContext(ctx) while handling a message, so they can't cause a
+// loop, other messages they log are only limited by the rate.
+package forward
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+	"github.com/kernelschmelze/pkg/logger"
+	manager "github.com/kernelschmelze/pkg/plugin/manager"
+)
+
+const (
+	// DefaultAction is the action name of the dispatched messages.
+	DefaultAction = "log"
+
+	// SinkName is the name of the sink registered by Enable.
+	SinkName = "forward"
+
+	// FieldName marks the context of forwarded messages.
+	FieldName = "log_forward"
+)
+
+// Config configures the forwarding, the rate limit allows Burst messages
+// at once and Rate messages per second on average.
+type Config struct {
+	Level  logger.Level // defaults to ErrorLevel, DebugLevel is not supported
+	Action string       // defaults to DefaultAction
+	Rate   float64      // defaults to 1
+	Burst  int          // defaults to 10
+	Clock  clock.Clock  // defaults to clock.System
+}
+
+// Message is the payload of the dispatched messages.
+type Message struct {
+	logger.Entry
+
+	// Suppressed counts the messages dropped by the rate limit or a full
+	// dispatcher queue since the last dispatched message.
+	Suppressed int
+}
+
+type forwarder struct {
+	config     Config
+	tokens     float64
+	last       time.Time
+	suppressed int
+	mu         sync.Mutex
+}
+
+// Enable starts forwarding messages, an active forwarding is replaced.
+func Enable(config Config) {
+
+	if config.Level == logger.DebugLevel {
+		config.Level = logger.ErrorLevel
+	}
+
+	if len(config.Action) == 0 {
+		config.Action = DefaultAction
+	}
+
+	if config.Rate <= 0 {
+		config.Rate = 1
+	}
+
+	if config.Burst <= 0 {
+		config.Burst = 10
+	}
+
+	if config.Clock == nil {
+		config.Clock = clock.System
+	}
+
+	f := &forwarder{
+		config: config,
+		tokens: float64(config.Burst),
+		last:   config.Clock.Now(),
+	}
+
+	logger.AddSink(SinkName, logger.Sink{
+		Writer: f,
+		Level:  config.Level,
+		Filter: forwardable,
+	})
+}
+
+// Disable stops forwarding messages.
+func Disable() {
+	logger.RemoveSink(SinkName)
+}
+
+// forwardable reports if the entry may be forwarded without risking a loop.
+func forwardable(e logger.Entry) bool {
+
+	if e.Component == SinkName {
+		return false
+	}
+
+	_, marked := e.Fields[FieldName]
+
+	return !marked
+}
+
+func (f *forwarder) Write(p []byte) (int, error) {
+
+	entry, err := logger.DecodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.allow() {
+		f.suppressed++
+		return len(p), nil
+	}
+
+	msg := Message{
+		Entry:      entry,
+		Suppressed: f.suppressed,
+	}
+
+	// plugins logging with this context are recognized by the field
+	ctx := logger.WithContext(context.Background(), logger.Field{Key: FieldName, Value: true})
+
+	// the dispatcher may be the caller, blocking could dead lock
+	if !manager.TryDispatchContext(ctx, manager.NewMessage(f.config.Action, msg)) {
+		f.suppressed++
+		return len(p), nil
+	}
+
+	f.suppressed = 0
+
+	return len(p), nil
+}
+
+// allow takes a token from the bucket.
+func (f *forwarder) allow() bool {
+
+	now := f.config.Clock.Now()
+
+	if elapsed := now.Sub(f.last); elapsed > 0 {
+		f.tokens += elapsed.Seconds() * f.config.Rate
+		if max := float64(f.config.Burst); f.tokens > max {
+			f.tokens = max
+		}
+	}
+
+	f.last = now
+
+	if f.tokens < 1 {
+		return false
+	}
+
+	f.tokens--
+
+	return true
+}
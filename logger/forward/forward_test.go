@@ -0,0 +1,90 @@
+package forward_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/logger"
+	"github.com/kernelschmelze/pkg/logger/forward"
+	manager "github.com/kernelschmelze/pkg/plugin/manager"
+	"github.com/kernelschmelze/pkg/plugin/plugin"
+)
+
+// alerter logs with the context of the message while handling it.
+type alerter struct {
+	plugin.Plugin
+	handled chan forward.Message
+	release chan struct{}
+}
+
+func (p *alerter) IsActivated() bool               { return true }
+func (p *alerter) WantsContext(action string) bool { return action == forward.DefaultAction }
+
+func (p *alerter) DoContext(ctx context.Context, v interface{}) error {
+	return nil
+}
+
+func (p *alerter) DoActionContext(ctx context.Context, action string, v interface{}) error {
+
+	msg := v.(forward.Message)
+
+	logger.FromContext(ctx).Errorf("alert for %s failed", msg.Message)
+
+	p.handled <- msg
+	<-p.release
+
+	return nil
+}
+
+func TestForwardWhileHandling(t *testing.T) {
+
+	p := &alerter{
+		handled: make(chan forward.Message, 8),
+		release: make(chan struct{}),
+	}
+
+	m := manager.GetManager()
+	if err := m.AddPlugin(p); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Start()
+	defer m.Stop()
+
+	forward.Enable(forward.Config{Rate: 1000, Burst: 10})
+	defer forward.Disable()
+
+	logger.Error("disk full")
+
+	next := func() string {
+		select {
+		case msg := <-p.handled:
+			return msg.Message
+		case <-time.After(2 * time.Second):
+			t.Fatal("message not forwarded")
+		}
+		return ""
+	}
+
+	if got := next(); got != "disk full" {
+		t.Fatalf("got %q, want %q", got, "disk full")
+	}
+
+	// the plugin is handling the message, errors of other goroutines are
+	// forwarded anyway
+	logger.Error("connect db failed")
+
+	close(p.release)
+
+	if got := next(); got != "connect db failed" {
+		t.Fatalf("got %q, want %q", got, "connect db failed")
+	}
+
+	// the errors logged by the plugin are not forwarded
+	select {
+	case msg := <-p.handled:
+		t.Fatalf("forwarded %q", msg.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -1,5 +1,9 @@
 package logger
 
+import (
+	"github.com/rs/zerolog"
+)
+
 var l *Logger
 
 func init() {
@@ -35,22 +39,27 @@ type SimpleLogger interface {
 
 	// Log formatted messages with level DEBUG
 	Debugf(string, ...interface{})
+
+	// Return a child logger which adds the fields to every message
+	With(...Field) SimpleLogger
 }
 
-func (*DefaultLog) Error(a ...interface{})            { l.Error(a...) }
-func (*DefaultLog) Errorf(f string, a ...interface{}) { l.Errorf(f, a...) }
-func (*DefaultLog) Warn(a ...interface{})             { l.Warn(a...) }
-func (*DefaultLog) Warnf(f string, a ...interface{})  { l.Warnf(f, a...) }
-func (*DefaultLog) Info(a ...interface{})             { l.Info(a...) }
-func (*DefaultLog) Infof(f string, a ...interface{})  { l.Infof(f, a...) }
-func (*DefaultLog) Debug(a ...interface{})            { l.Debug(a...) }
-func (*DefaultLog) Debugf(f string, a ...interface{}) { l.Debugf(f, a...) }
-
-func Error(a ...interface{})            { l.Error(a...) }
-func Errorf(f string, a ...interface{}) { l.Errorf(f, a...) }
-func Warn(a ...interface{})             { l.Warn(a...) }
-func Warnf(f string, a ...interface{})  { l.Warnf(f, a...) }
-func Info(a ...interface{})             { l.Info(a...) }
-func Infof(f string, a ...interface{})  { l.Infof(f, a...) }
-func Debug(a ...interface{})            { l.Debug(a...) }
-func Debugf(f string, a ...interface{}) { l.Debugf(f, a...) }
+func (*DefaultLog) Error(a ...interface{})            { l.log(zerolog.ErrorLevel, "%s", a...) }
+func (*DefaultLog) Errorf(f string, a ...interface{}) { l.log(zerolog.ErrorLevel, f, a...) }
+func (*DefaultLog) Warn(a ...interface{})             { l.log(zerolog.WarnLevel, "%s", a...) }
+func (*DefaultLog) Warnf(f string, a ...interface{})  { l.log(zerolog.WarnLevel, f, a...) }
+func (*DefaultLog) Info(a ...interface{})             { l.log(zerolog.InfoLevel, "%s", a...) }
+func (*DefaultLog) Infof(f string, a ...interface{})  { l.log(zerolog.InfoLevel, f, a...) }
+func (*DefaultLog) Debug(a ...interface{})            { l.log(zerolog.DebugLevel, "%s", a...) }
+func (*DefaultLog) Debugf(f string, a ...interface{}) { l.log(zerolog.DebugLevel, f, a...) }
+func (*DefaultLog) With(fields ...Field) SimpleLogger { return l.With(fields...) }
+
+func Error(a ...interface{})            { l.log(zerolog.ErrorLevel, "%s", a...) }
+func Errorf(f string, a ...interface{}) { l.log(zerolog.ErrorLevel, f, a...) }
+func Warn(a ...interface{})             { l.log(zerolog.WarnLevel, "%s", a...) }
+func Warnf(f string, a ...interface{})  { l.log(zerolog.WarnLevel, f, a...) }
+func Info(a ...interface{})             { l.log(zerolog.InfoLevel, "%s", a...) }
+func Infof(f string, a ...interface{})  { l.log(zerolog.InfoLevel, f, a...) }
+func Debug(a ...interface{})            { l.log(zerolog.DebugLevel, "%s", a...) }
+func Debugf(f string, a ...interface{}) { l.log(zerolog.DebugLevel, f, a...) }
+func With(fields ...Field) SimpleLogger { return l.With(fields...) }
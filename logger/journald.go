@@ -0,0 +1,185 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// JournalConfig configures a journald output.
+type JournalConfig struct {
+	Addr       string // defaults to "/run/systemd/journal/socket"
+	Identifier string // SYSLOG_IDENTIFIER, defaults to the program name
+}
+
+// Journal writes messages with the native journald protocol, the fields
+// of a message are stored as journal fields. It implements io.Writer and
+// can be added with AddOutput.
+type Journal struct {
+	config JournalConfig
+	addr   *net.UnixAddr
+	conn   *net.UnixConn
+	mu     sync.Mutex
+}
+
+// NewJournal connects to the journald socket.
+func NewJournal(config JournalConfig) (*Journal, error) {
+
+	if len(config.Addr) == 0 {
+		config.Addr = "/run/systemd/journal/socket"
+	}
+
+	if len(config.Identifier) == 0 {
+		config.Identifier = filepath.Base(os.Args[0])
+	}
+
+	if _, err := os.Stat(config.Addr); err != nil {
+		return nil, err
+	}
+
+	// the socket is not connected, file descriptors can only be passed
+	// with an explicit destination address
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{
+		config: config,
+		addr:   &net.UnixAddr{Name: config.Addr, Net: "unixgram"},
+		conn:   conn,
+	}, nil
+}
+
+func (j *Journal) Write(p []byte) (int, error) {
+
+	entry, err := DecodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+
+	data := j.format(entry)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil {
+		return 0, net.ErrClosed
+	}
+
+	_, err = j.conn.WriteToUnix(data, j.addr)
+
+	// the message is too large for a datagram, pass it as file descriptor
+	if errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS) {
+		err = j.sendFile(data, err)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (j *Journal) Close() error {
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.conn == nil {
+		return nil
+	}
+
+	err := j.conn.Close()
+	j.conn = nil
+
+	return err
+}
+
+func (j *Journal) format(entry Entry) []byte {
+
+	var buf bytes.Buffer
+
+	journalField(&buf, "MESSAGE", entry.Message)
+	journalField(&buf, "PRIORITY", strconv.Itoa(severity(entry.Level)))
+	journalField(&buf, "SYSLOG_IDENTIFIER", j.config.Identifier)
+
+	if len(entry.Component) > 0 {
+		journalField(&buf, "COMPONENT", entry.Component)
+	}
+
+	if offset := strings.LastIndex(entry.Caller, ":"); offset > 0 {
+		journalField(&buf, "CODE_FILE", entry.Caller[:offset])
+		journalField(&buf, "CODE_LINE", entry.Caller[offset+1:])
+	}
+
+	keys := make([]string, 0, len(entry.Fields))
+	for key := range entry.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		journalField(&buf, journalName(key), fieldString(entry.Fields[key]))
+	}
+
+	return buf.Bytes()
+}
+
+// journalField appends a field in the native protocol format, values with
+// newlines are written as binary safe length prefixed value.
+func journalField(buf *bytes.Buffer, name string, value string) {
+
+	buf.WriteString(name)
+
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+
+	buf.WriteByte('\n')
+	buf.Write(size[:])
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journalName returns a valid journal field name, it consists of upper
+// case letters, digits and underscores and must not start with an
+// underscore or a digit.
+func journalName(s string) string {
+
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, s)
+
+	s = strings.TrimLeft(s, "_")
+
+	if len(s) == 0 || (s[0] >= '0' && s[0] <= '9') {
+		s = "F_" + s
+	}
+
+	if len(s) > 64 {
+		s = s[:64]
+	}
+
+	return s
+}
@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"os"
+	"syscall"
+)
+
+// sendFile passes the message as file descriptor of an unlinked temporary
+// file, used by journald for messages larger than a datagram.
+func (j *Journal) sendFile(data []byte, _ error) error {
+
+	f, err := os.CreateTemp("/dev/shm", "journal.")
+	if err != nil {
+		if f, err = os.CreateTemp("", "journal."); err != nil {
+			return err
+		}
+	}
+
+	defer f.Close()
+
+	if err = os.Remove(f.Name()); err != nil {
+		return err
+	}
+
+	if _, err = f.Write(data); err != nil {
+		return err
+	}
+
+	rights := syscall.UnixRights(int(f.Fd()))
+	_, _, err = j.conn.WriteMsgUnix(nil, rights, j.addr)
+
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package logger
+
+// sendFile is not supported, journald is only available on linux.
+func (j *Journal) sendFile(_ []byte, err error) error {
+	return err
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// parseJournal decodes the native journald protocol.
+func parseJournal(t *testing.T, data string) map[string]string {
+
+	t.Helper()
+
+	fields := make(map[string]string)
+
+	for len(data) > 0 {
+
+		end := strings.IndexAny(data, "=\n")
+		if end < 0 {
+			t.Fatalf("truncated field %q", data)
+		}
+
+		name := data[:end]
+
+		if data[end] == '=' {
+			data = data[end+1:]
+			eol := strings.IndexByte(data, '\n')
+			if eol < 0 {
+				t.Fatalf("unterminated field %s", name)
+			}
+			fields[name] = data[:eol]
+			data = data[eol+1:]
+			continue
+		}
+
+		data = data[end+1:]
+		if len(data) < 8 {
+			t.Fatalf("truncated size of field %s", name)
+		}
+
+		size := int(binary.LittleEndian.Uint64([]byte(data[:8])))
+		data = data[8:]
+		if len(data) < size+1 || data[size] != '\n' {
+			t.Fatalf("truncated value of field %s", name)
+		}
+
+		fields[name] = data[:size]
+		data = data[size+1:]
+	}
+
+	return fields
+}
+
+func TestJournalFields(t *testing.T) {
+
+	t.Parallel()
+
+	conn := listenUnixgram(t)
+
+	j, err := NewJournal(JournalConfig{Addr: conn.LocalAddr().String(), Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	line := `{"level":"warn","time":"2024-07-21T15:56:49.278492Z","component":"db",` +
+		`"caller":"/src/main.go:21","req-id":"a\nb","n":2,"_private":true,"9lives":"x",` +
+		`"message":"connect failed"}`
+
+	if _, err := j.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := parseJournal(t, readDatagram(t, conn))
+
+	want := map[string]string{
+		"MESSAGE":           "connect failed",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"COMPONENT":         "db",
+		"CODE_FILE":         "/src/main.go",
+		"CODE_LINE":         "21",
+		"REQ_ID":            "a\nb",
+		"N":                 "2",
+		"PRIVATE":           "true",
+		"F_9LIVES":          "x",
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("got %d fields %v, want %d", len(got), got, len(want))
+	}
+
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("field %s = %q, want %q", name, got[name], value)
+		}
+	}
+}
+
+func TestJournalLargeMessage(t *testing.T) {
+
+	t.Parallel()
+
+	conn := listenUnixgram(t)
+
+	j, err := NewJournal(JournalConfig{Addr: conn.LocalAddr().String(), Identifier: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	msg := strings.Repeat("x", 1<<20)
+
+	if _, err := j.Write([]byte(`{"level":"info","message":"` + msg + `"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the message is passed as file descriptor, the datagram is empty
+	buf := make([]byte, 16)
+	oob := make([]byte, 128)
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 0 || oobn == 0 {
+		t.Fatalf("got %d bytes and %d bytes of control data, want a file descriptor", n, oobn)
+	}
+}
+
+func TestJournalFieldEncoding(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	journalField(&buf, "A", "b")
+	journalField(&buf, "C", "d\ne")
+
+	want := "A=b\nC\n\x03\x00\x00\x00\x00\x00\x00\x00d\ne\n"
+
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
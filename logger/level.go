@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// Level is the severity of a message.
+type Level = zerolog.Level
+
+const (
+	DebugLevel = zerolog.DebugLevel
+	InfoLevel  = zerolog.InfoLevel
+	WarnLevel  = zerolog.WarnLevel
+	ErrorLevel = zerolog.ErrorLevel
+	FatalLevel = zerolog.FatalLevel
+	PanicLevel = zerolog.PanicLevel
+	NoLevel    = zerolog.NoLevel
+)
+
+// ComponentFieldName is the field name used to tag messages of named loggers.
+var ComponentFieldName = "component"
+
+var (
+	levelGuard sync.RWMutex
+	level      = zerolog.DebugLevel
+	levels     = make(map[string]zerolog.Level)
+)
+
+// Named returns a logger which tags every message with the component name
+// and uses the level configured for the name.
+func Named(name string) SimpleLogger {
+	return &Logger{name: name}
+}
+
+// SetLevel sets the minimum level of all loggers without an own level.
+func SetLevel(lvl string) error {
+
+	parsed, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+
+	levelGuard.Lock()
+	level = parsed
+	levelGuard.Unlock()
+
+	return nil
+}
+
+// SetComponentLevel sets the minimum level of the named logger.
+func SetComponentLevel(name string, lvl string) error {
+
+	parsed, err := ParseLevel(lvl)
+	if err != nil {
+		return err
+	}
+
+	levelGuard.Lock()
+	levels[name] = parsed
+	levelGuard.Unlock()
+
+	return nil
+}
+
+// ResetComponentLevel removes the level of the named logger, it falls back
+// to the default level.
+func ResetComponentLevel(name string) {
+	levelGuard.Lock()
+	delete(levels, name)
+	levelGuard.Unlock()
+}
+
+func enabled(name string, lvl zerolog.Level) bool {
+
+	levelGuard.RLock()
+	min := level
+	if len(name) > 0 {
+		if l, exist := levels[name]; exist {
+			min = l
+		}
+	}
+	levelGuard.RUnlock()
+
+	return lvl >= min
+}
+
+// ParseLevel parses a level name like "debug", "info", "warn" or "error".
+func ParseLevel(lvl string) (Level, error) {
+
+	switch strings.ToLower(strings.TrimSpace(lvl)) {
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "warn", "warning":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	case "fatal":
+		return zerolog.FatalLevel, nil
+	case "panic":
+		return zerolog.PanicLevel, nil
+	case "off", "disabled", "none":
+		return zerolog.Disabled, nil
+	}
+
+	return zerolog.NoLevel, fmt.Errorf("unknown log level '%s'", lvl)
+}
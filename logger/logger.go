@@ -1,62 +1,132 @@
 package logger
 
 import (
+	"fmt"
 	"os"
+	"runtime"
+	"strconv"
 
 	"github.com/rs/zerolog"
 )
 
 var (
-	timeFormat = "0102 15:04:05.000000"
-	logger     = zerolog.New(os.Stderr).With().Timestamp().Caller().Logger()
+	timeFormat      = "0102 15:04:05.000000"
+	fieldTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	logger          = zerolog.New(os.Stderr).Hook(timestampHook)
 )
 
 type Logger struct {
+	name   string
+	fields []Field
 }
 
 func newLogger() *Logger {
-	zerolog.CallerSkipFrameCount = 4
 	return &Logger{}
 }
 
 func init() {
 
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	zerolog.TimeFieldFormat = timeFormat
+	zerolog.TimeFieldFormat = fieldTimeFormat
 
-	output := getConsoleWriter()
-	logger = logger.Output(output)
+	outputs.add("console", Sink{Writer: os.Stderr, Format: FormatConsole})
+	logger = logger.Output(outputs)
 
 }
 
+// With returns a child logger which adds the given fields to every message.
+func (l *Logger) With(fields ...Field) SimpleLogger {
+
+	child := &Logger{
+		name:   l.name,
+		fields: make([]Field, 0, len(l.fields)+len(fields)),
+	}
+
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+
+	return child
+}
+
 func (l *Logger) Error(v ...interface{}) {
-	logger.Error().Msgf("%s", v...)
+	l.log(zerolog.ErrorLevel, "%s", v...)
 }
 
 func (l *Logger) Errorf(f string, v ...interface{}) {
-	logger.Error().Msgf(f, v...)
+	l.log(zerolog.ErrorLevel, f, v...)
 }
 
 func (l *Logger) Warn(v ...interface{}) {
-	logger.Warn().Msgf("%s", v...)
+	l.log(zerolog.WarnLevel, "%s", v...)
 }
 
 func (l *Logger) Warnf(f string, v ...interface{}) {
-	logger.Warn().Msgf(f, v...)
+	l.log(zerolog.WarnLevel, f, v...)
 }
 
 func (l *Logger) Info(v ...interface{}) {
-	logger.Info().Msgf("%s", v...)
+	l.log(zerolog.InfoLevel, "%s", v...)
 }
 
 func (l *Logger) Infof(f string, v ...interface{}) {
-	logger.Info().Msgf(f, v...)
+	l.log(zerolog.InfoLevel, f, v...)
 }
 
 func (l *Logger) Debug(v ...interface{}) {
-	logger.Debug().Msgf("%s", v...)
+	l.log(zerolog.DebugLevel, "%s", v...)
 }
 
 func (l *Logger) Debugf(f string, v ...interface{}) {
-	logger.Debug().Msgf(f, v...)
+	l.log(zerolog.DebugLevel, f, v...)
+}
+
+// log must be called directly by the exported functions, otherwise the
+// caller frame is off.
+func (l *Logger) log(lvl zerolog.Level, f string, v ...interface{}) {
+
+	if !enabled(l.name, lvl) {
+		return
+	}
+
+	var caller string
+	if _, file, line, ok := runtime.Caller(2); ok {
+		caller = file + ":" + strconv.Itoa(line)
+	}
+
+	l.write(lvl, caller, fmt.Sprintf(f, v...))
+}
+
+// write passes the message through the filters to the outputs, the level
+// has to be checked by the caller.
+func (l *Logger) write(lvl zerolog.Level, caller string, msg string, fields ...Field) {
+
+	red := getRedactor()
+	msg = red.message(msg)
+
+	if !filters.allow(l, lvl, msg) {
+		return
+	}
+
+	e := logger.WithLevel(lvl)
+	if e == nil {
+		return
+	}
+
+	if len(l.name) > 0 {
+		e = e.Str(ComponentFieldName, l.name)
+	}
+
+	for i := range l.fields {
+		e = red.field(l.fields[i]).apply(e)
+	}
+
+	for i := range fields {
+		e = red.field(fields[i]).apply(e)
+	}
+
+	if len(caller) > 0 {
+		e = e.Str(zerolog.CallerFieldName, caller)
+	}
+
+	e.Msg(msg)
 }
@@ -0,0 +1,289 @@
+// Package logtest captures the messages of the logger package in tests.
+//
+//	func TestFetch(t *testing.T) {
+//		t.Parallel()
+//		rec := logtest.New(t)
+//
+//		fetch(rec.Context(context.Background()))
+//
+//		rec.AssertLogged(t, logger.ErrorLevel, "timeout")
+//	}
+//
+// While a recorder is active the messages are not written to the sinks and
+// sampling and duplicate suppression are bypassed. A recorder captures only
+// the messages logged with its logger or context, so the code under test
+// has to log through rec.Logger or rec.Context. Tests which don't run in
+// parallel may capture all other messages, too:
+//
+//	func TestSend(t *testing.T) {
+//		rec := logtest.New(t).CaptureUnbound()
+//
+//		send()
+//
+//		rec.AssertLogged(t, logger.WarnLevel, "retry")
+//		rec.AssertField(t, "attempt", 2)
+//	}
+package logtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/logger"
+	"github.com/rs/zerolog"
+)
+
+// FieldName is the key of the field which binds a message to a recorder,
+// it is removed from the captured messages.
+const FieldName = "logtest"
+
+var recorders uint64
+
+// Recorder keeps the captured messages.
+type Recorder struct {
+	id      string
+	unbound int32
+	entries []logger.Entry
+	mu      sync.RWMutex
+}
+
+// New returns a recorder which captures the messages until the test and
+// its subtests have finished.
+func New(t testing.TB) *Recorder {
+
+	r := &Recorder{
+		id: strconv.FormatUint(atomic.AddUint64(&recorders, 1), 10),
+	}
+
+	release := logger.CaptureAll(r)
+	t.Cleanup(release)
+
+	return r
+}
+
+// CaptureUnbound captures the messages which are not bound to a recorder,
+// too. Every recorder doing so gets them, it is not safe with t.Parallel.
+func (r *Recorder) CaptureUnbound() *Recorder {
+	atomic.StoreInt32(&r.unbound, 1)
+	return r
+}
+
+// Field returns the field which binds a message to the recorder.
+func (r *Recorder) Field() logger.Field {
+	return logger.Field{Key: FieldName, Value: r.id}
+}
+
+// Logger returns a named logger whose messages are only captured by the
+// recorder.
+func (r *Recorder) Logger(name string) logger.SimpleLogger {
+	return logger.Named(name).With(r.Field())
+}
+
+// Context returns a copy of ctx, the messages of logger.FromContext are
+// only captured by the recorder.
+func (r *Recorder) Context(ctx context.Context) context.Context {
+	return logger.WithContext(ctx, r.Field())
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+
+	entry, err := logger.DecodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+
+	id, bound := entry.Fields[FieldName]
+
+	switch {
+	case bound && id != r.id:
+		return len(p), nil
+	case !bound && atomic.LoadInt32(&r.unbound) == 0:
+		return len(p), nil
+	}
+
+	delete(entry.Fields, FieldName)
+
+	r.mu.Lock()
+	r.entries = append(r.entries, entry)
+	r.mu.Unlock()
+
+	return len(p), nil
+}
+
+// Entries returns the captured messages.
+func (r *Recorder) Entries() []logger.Entry {
+
+	logger.Flush()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entries := make([]logger.Entry, len(r.entries))
+	copy(entries, r.entries)
+
+	return entries
+}
+
+// Filter returns the captured messages matching the query.
+func (r *Recorder) Filter(q logger.Query) []logger.Entry {
+
+	var result []logger.Entry
+
+	for _, e := range r.Entries() {
+		if q.Match(e) {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// Reset drops the captured messages.
+func (r *Recorder) Reset() {
+
+	logger.Flush()
+
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// Logged reports if a message with the level containing msg was captured.
+func (r *Recorder) Logged(lvl logger.Level, msg string) bool {
+
+	for _, e := range r.Entries() {
+		if e.Level == lvl && strings.Contains(e.Message, msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasField reports if a message with the field was captured, the values
+// are compared by their JSON encoding.
+func (r *Recorder) HasField(key string, value interface{}) bool {
+
+	want := encode(value)
+
+	for _, e := range r.Entries() {
+
+		if v, exist := field(e, key); exist && encode(v) == want {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AssertLogged fails the test if no message with the level containing msg
+// was captured.
+func (r *Recorder) AssertLogged(t testing.TB, lvl logger.Level, msg string) bool {
+
+	t.Helper()
+
+	if r.Logged(lvl, msg) {
+		return true
+	}
+
+	t.Errorf("no %s message containing %q logged, got:\n%s", lvl, msg, r.dump())
+
+	return false
+}
+
+// AssertNotLogged fails the test if a message with the level containing
+// msg was captured.
+func (r *Recorder) AssertNotLogged(t testing.TB, lvl logger.Level, msg string) bool {
+
+	t.Helper()
+
+	if !r.Logged(lvl, msg) {
+		return true
+	}
+
+	t.Errorf("unexpected %s message containing %q logged, got:\n%s", lvl, msg, r.dump())
+
+	return false
+}
+
+// AssertField fails the test if no message with the field was captured.
+func (r *Recorder) AssertField(t testing.TB, key string, value interface{}) bool {
+
+	t.Helper()
+
+	if r.HasField(key, value) {
+		return true
+	}
+
+	t.Errorf("no message with field %s=%s logged, got:\n%s", key, encode(value), r.dump())
+
+	return false
+}
+
+func (r *Recorder) dump() string {
+
+	var b strings.Builder
+
+	for _, e := range r.Entries() {
+
+		fmt.Fprintf(&b, "\t%s %s", e.Level, e.Message)
+
+		if len(e.Component) > 0 {
+			fmt.Fprintf(&b, " %s=%s", logger.ComponentFieldName, e.Component)
+		}
+
+		for k, v := range e.Fields {
+			fmt.Fprintf(&b, " %s=%s", k, encode(v))
+		}
+
+		b.WriteByte('\n')
+	}
+
+	if b.Len() == 0 {
+		return "\t(nothing)\n"
+	}
+
+	return b.String()
+}
+
+// field returns a field of the entry, the component is a field, too.
+func field(e logger.Entry, key string) (interface{}, bool) {
+
+	if key == logger.ComponentFieldName && len(e.Component) > 0 {
+		return e.Component, true
+	}
+
+	v, exist := e.Fields[key]
+
+	return v, exist
+}
+
+func encode(v interface{}) string {
+
+	switch vv := v.(type) {
+	case json.Number:
+	case time.Duration:
+		// encoded like zerolog encodes durations
+		v = float64(vv) / float64(zerolog.DurationFieldUnit)
+	case error:
+		v = vv.Error()
+	case fmt.Stringer:
+		if _, ok := v.(json.Marshaler); !ok {
+			v = vv.String()
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,96 @@
+package logtest_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/logger"
+	"github.com/kernelschmelze/pkg/logger/logtest"
+)
+
+func TestRecorder(t *testing.T) {
+
+	rec := logtest.New(t)
+
+	rec.Logger("db").With(logger.Int("attempt", 2), logger.Duration("wait", time.Second)).Warn("retry")
+
+	rec.AssertLogged(t, logger.WarnLevel, "retry")
+	rec.AssertNotLogged(t, logger.ErrorLevel, "retry")
+	rec.AssertField(t, "attempt", 2)
+	rec.AssertField(t, "wait", time.Second)
+	rec.AssertField(t, logger.ComponentFieldName, "db")
+
+	if entries := rec.Filter(logger.Query{Component: "db"}); len(entries) != 1 {
+		t.Fatalf("got %d entries of db, want 1", len(entries))
+	}
+
+	rec.Reset()
+
+	if entries := rec.Entries(); len(entries) != 0 {
+		t.Fatalf("got %d entries after reset, want 0", len(entries))
+	}
+}
+
+func TestParallelRecorders(t *testing.T) {
+
+	// identical messages of the parallel tests must not be dropped
+	logger.SetDedup(time.Minute)
+	defer logger.SetDedup(0)
+
+	t.Run("group", func(t *testing.T) {
+
+		for i := 0; i < 8; i++ {
+
+			i := i
+
+			t.Run(strconv.Itoa(i), func(t *testing.T) {
+
+				t.Parallel()
+
+				rec := logtest.New(t)
+				ctx := rec.Context(context.Background())
+
+				rec.Logger("worker").With(logger.Int("worker", i)).Error("job failed")
+				logger.FromContext(ctx).Info("done")
+
+				// unbound messages of the other tests are not captured
+				logger.Info("unbound")
+
+				entries := rec.Entries()
+
+				if len(entries) != 2 {
+					t.Fatalf("got %d messages, want the 2 of this test:\n%v", len(entries), entries)
+				}
+
+				for _, e := range entries {
+					if _, exist := e.Fields[logtest.FieldName]; exist {
+						t.Errorf("field %s not removed from %q", logtest.FieldName, e.Message)
+					}
+				}
+
+				rec.AssertLogged(t, logger.ErrorLevel, "job failed")
+				rec.AssertField(t, "worker", i)
+			})
+		}
+	})
+}
+
+func TestUnboundMessages(t *testing.T) {
+
+	first := logtest.New(t).CaptureUnbound()
+	second := logtest.New(t)
+
+	logger.Info("unbound")
+	first.Logger("").Info("first only")
+	second.Logger("").Info("second only")
+
+	first.AssertLogged(t, logger.InfoLevel, "unbound")
+	second.AssertNotLogged(t, logger.InfoLevel, "unbound")
+
+	first.AssertLogged(t, logger.InfoLevel, "first only")
+	first.AssertNotLogged(t, logger.InfoLevel, "second only")
+	second.AssertLogged(t, logger.InfoLevel, "second only")
+	second.AssertNotLogged(t, logger.InfoLevel, "first only")
+}
@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"io"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Format is the encoding of the messages written to a sink.
+type Format string
+
+const (
+	FormatJSON    Format = "json"    // one JSON object per line
+	FormatConsole Format = "console" // human readable, colorized on a terminal
+)
+
+// Sink receives the messages with at least the minimum level which pass the
+// filter. A nil filter passes every message.
+type Sink struct {
+	Writer io.Writer
+	Level  Level
+	Format Format
+	Filter func(Entry) bool
+}
+
+var (
+	outputs = &output{}
+
+	// direct writes to the outputs, bypassing the asynchronous writer
+	direct = zerolog.New(syncOutput{}).Hook(timestampHook)
+)
+
+// AddSink adds a named sink, an existing sink with the same name is
+// replaced and its writer closed. The default sink is named "console".
+func AddSink(name string, sink Sink) {
+
+	if prev := outputs.add(name, sink); prev != nil && !sameWriter(prev, sink.Writer) {
+		closeWriter(prev)
+	}
+}
+
+// RemoveSink removes the named sink and closes its writer if it is an
+// io.Closer, os.Stdout and os.Stderr are never closed.
+func RemoveSink(name string) error {
+	return closeWriter(outputs.remove(name))
+}
+
+// SinkNames returns the names of the registered sinks.
+func SinkNames() []string {
+
+	outputs.mu.RLock()
+	defer outputs.mu.RUnlock()
+
+	names := make([]string, 0, len(outputs.sinks))
+	for i := range outputs.sinks {
+		names = append(names, outputs.sinks[i].name)
+	}
+
+	return names
+}
+
+// Capture redirects all messages as JSON lines to w instead of the sinks
+// until release is called. Captures may overlap, every active capture
+// receives all messages and the sinks are used again after the last
+// capture is released.
+func Capture(w io.Writer) (release func()) {
+	return capture(w, false)
+}
+
+// CaptureAll captures the messages like Capture, while it is active
+// sampling and duplicate suppression are bypassed, every message with an
+// enabled level is written.
+func CaptureAll(w io.Writer) (release func()) {
+	return capture(w, true)
+}
+
+func capture(w io.Writer, all bool) (release func()) {
+
+	c := &capturer{w: w}
+
+	if all {
+		atomic.AddInt32(&outputs.unfiltered, 1)
+	}
+
+	outputs.mu.Lock()
+	outputs.captures = append(outputs.captures, c)
+	outputs.mu.Unlock()
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+
+			// deliver the messages queued for the capture
+			Flush()
+
+			if all {
+				atomic.AddInt32(&outputs.unfiltered, -1)
+			}
+
+			outputs.mu.Lock()
+			defer outputs.mu.Unlock()
+
+			for i := range outputs.captures {
+				if outputs.captures[i] == c {
+					outputs.captures = append(outputs.captures[:i:i], outputs.captures[i+1:]...)
+					return
+				}
+			}
+		})
+	}
+}
+
+// AddOutput adds a named sink which receives every message as JSON
+// encoded line.
+func AddOutput(name string, w io.Writer) {
+	AddSink(name, Sink{Writer: w, Format: FormatJSON})
+}
+
+// RemoveOutput removes the named sink, see RemoveSink.
+func RemoveOutput(name string) error {
+	return RemoveSink(name)
+}
+
+type namedSink struct {
+	Sink
+	name string
+	out  io.Writer
+}
+
+type output struct {
+	unfiltered int32 // number of captures bypassing the filters
+	sinks      []namedSink
+	captures   []*capturer
+	async      *asyncWriter
+	mu         sync.RWMutex
+}
+
+type capturer struct {
+	w io.Writer
+}
+
+type syncOutput struct{}
+
+func (syncOutput) Write(p []byte) (int, error) {
+	return outputs.writeAll(zerolog.NoLevel, p)
+}
+
+func (syncOutput) WriteLevel(lvl zerolog.Level, p []byte) (int, error) {
+	return outputs.writeAll(lvl, p)
+}
+
+func (o *output) add(name string, sink Sink) io.Writer {
+
+	s := namedSink{
+		Sink: sink,
+		name: name,
+		out:  sink.Writer,
+	}
+
+	if sink.Format == FormatConsole {
+		console := newConsoleWriter(sink.Writer, !isTerminal(sink.Writer))
+		s.out = &console
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.sinks {
+		if o.sinks[i].name == name {
+			prev := o.sinks[i].Writer
+			o.sinks[i] = s
+			return prev
+		}
+	}
+
+	o.sinks = append(o.sinks, s)
+
+	return nil
+}
+
+func (o *output) remove(name string) io.Writer {
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.sinks {
+		if o.sinks[i].name == name {
+			w := o.sinks[i].Writer
+			o.sinks = append(o.sinks[:i:i], o.sinks[i+1:]...)
+			return w
+		}
+	}
+
+	return nil
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	return o.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (o *output) WriteLevel(lvl zerolog.Level, p []byte) (int, error) {
+
+	o.mu.RLock()
+	async := o.async
+	o.mu.RUnlock()
+
+	if async != nil {
+		return async.write(lvl, p)
+	}
+
+	return o.writeAll(lvl, p)
+}
+
+func (o *output) setAsync(a *asyncWriter) *asyncWriter {
+
+	o.mu.Lock()
+	prev := o.async
+	o.async = a
+	o.mu.Unlock()
+
+	return prev
+}
+
+func (o *output) flush() {
+
+	o.mu.RLock()
+	async := o.async
+	o.mu.RUnlock()
+
+	if async != nil {
+		async.flush()
+	}
+}
+
+// writeAll writes the message to all sinks accepting it.
+func (o *output) writeAll(lvl zerolog.Level, p []byte) (int, error) {
+
+	var err error
+	var entry *Entry
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if len(o.captures) > 0 {
+		for _, c := range o.captures {
+			if _, wErr := c.w.Write(p); err == nil {
+				err = wErr
+			}
+		}
+		return len(p), err
+	}
+
+	for i := range o.sinks {
+
+		s := &o.sinks[i]
+
+		if lvl != zerolog.NoLevel && lvl < s.Level {
+			continue
+		}
+
+		if s.Filter != nil {
+
+			// decode once for all filters
+			if entry == nil {
+				decoded, dErr := DecodeEntry(p)
+				if dErr != nil {
+					if err == nil {
+						err = dErr
+					}
+					continue
+				}
+				entry = &decoded
+			}
+
+			if !s.Filter(*entry) {
+				continue
+			}
+		}
+
+		var wErr error
+
+		if lw, ok := s.out.(zerolog.LevelWriter); ok {
+			_, wErr = lw.WriteLevel(lvl, p)
+		} else {
+			_, wErr = s.out.Write(p)
+		}
+
+		if err == nil {
+			err = wErr
+		}
+	}
+
+	return len(p), err
+}
+
+// sameWriter reports if both writers are the same, unlike == it doesn't
+// panic for writers of a non comparable type.
+func sameWriter(a, b io.Writer) bool {
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+
+	if !va.IsValid() || !vb.IsValid() || va.Type() != vb.Type() {
+		return false
+	}
+
+	if !va.Comparable() || !vb.Comparable() {
+		return false
+	}
+
+	return va.Equal(vb)
+}
+
+func closeWriter(w io.Writer) error {
+
+	if w == nil || w == os.Stdout || w == os.Stderr {
+		return nil
+	}
+
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+func isTerminal(w io.Writer) bool {
+
+	if w == os.Stdout || w == os.Stderr {
+		return !noColor
+	}
+
+	if f, ok := w.(*os.File); ok {
+		return terminal.IsTerminal(int(f.Fd()))
+	}
+
+	return false
+}
@@ -0,0 +1,442 @@
+package logger
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Redacted replaces masked values.
+const Redacted = "[REDACTED]"
+
+// Redaction configures the masking of sensitive data in messages and
+// fields. Fields are field names, matched case-insensitive against the
+// words of a key, e.g. "key" masks "api_key" and "apiKey". In messages
+// "name=value" and "name: value" pairs are masked. Patterns are regular
+// expressions, with a capture group only the first group is masked. The
+// built-in patterns "bearer" and "card" mask bearer tokens and card
+// numbers passing the Luhn check.
+//
+// Struct fields tagged with `log:"redact"` are always masked, fields
+// tagged with `log:"-"` are omitted. Values implementing json.Marshaler or
+// encoding.TextMarshaler are encoded by their marshaler, unless they are
+// structs with tagged or sensitive fields, those are masked like other
+// structs and the marshaler is bypassed.
+type Redaction struct {
+	Fields   []string `toml:"fields"`
+	Patterns []string `toml:"patterns"`
+}
+
+// DefaultRedaction masks common secrets, it is enabled by
+// SetRedaction(DefaultRedaction). Without it only tagged struct fields are
+// masked.
+var DefaultRedaction = Redaction{
+	Fields:   []string{"password", "passwd", "token", "secret", "key"},
+	Patterns: []string{"bearer", "card"},
+}
+
+type redactPattern struct {
+	re    *regexp.Regexp
+	valid func(s string) bool
+}
+
+type redactor struct {
+	fields   map[string]bool
+	pairs    *regexp.Regexp
+	patterns []redactPattern
+}
+
+var (
+	redactGuard sync.RWMutex
+	redact      *redactor
+
+	builtinPatterns = map[string]redactPattern{
+		"bearer": {re: regexp.MustCompile(`(?i)\bbearer\s+([a-z0-9\-._~+/]+=*)`)},
+		"card":   {re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+	}
+)
+
+func init() {
+	if err := SetRedaction(Redaction{}); err != nil {
+		panic(err)
+	}
+}
+
+// SetRedaction replaces the redaction config, an empty config disables the
+// masking except for tagged struct fields.
+func SetRedaction(r Redaction) error {
+
+	red, err := newRedactor(r)
+	if err != nil {
+		return err
+	}
+
+	redactGuard.Lock()
+	redact = red
+	redactGuard.Unlock()
+
+	return nil
+}
+
+func newRedactor(r Redaction) (*redactor, error) {
+
+	red := &redactor{
+		fields: make(map[string]bool, len(r.Fields)),
+	}
+
+	var names []string
+
+	for _, name := range r.Fields {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if len(name) == 0 {
+			continue
+		}
+		red.fields[name] = true
+		names = append(names, regexp.QuoteMeta(name))
+	}
+
+	if len(names) > 0 {
+		// name=value or name: value, the name may be part of a longer word
+		expr := `(?i)\b[\w.\-]*(?:` + strings.Join(names, "|") + `)[\w.\-]*["']?\s*[=:]\s*["']?([^\s,;&"'{}\[\]()]+)`
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		red.pairs = re
+	}
+
+	for _, pattern := range r.Patterns {
+
+		if p, exist := builtinPatterns[pattern]; exist {
+			red.patterns = append(red.patterns, p)
+			continue
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction pattern %s: %v", pattern, err)
+		}
+
+		red.patterns = append(red.patterns, redactPattern{re: re})
+	}
+
+	return red, nil
+}
+
+func getRedactor() *redactor {
+	redactGuard.RLock()
+	r := redact
+	redactGuard.RUnlock()
+	return r
+}
+
+// message masks the sensitive parts of a text.
+func (r *redactor) message(s string) string {
+
+	if r.pairs != nil {
+		s = r.pairs.ReplaceAllStringFunc(s, func(m string) string {
+			if !r.keyOfPair(m) {
+				return m
+			}
+			return maskGroup(r.pairs, m)
+		})
+	}
+
+	for _, p := range r.patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			if p.valid != nil && !p.valid(m) {
+				return m
+			}
+			return maskGroup(p.re, m)
+		})
+	}
+
+	return s
+}
+
+// keyOfPair reports if the key of a name=value match is a sensitive name,
+// the regular expression also matches names containing it as substring.
+func (r *redactor) keyOfPair(m string) bool {
+
+	end := strings.IndexAny(m, "=:")
+	if end < 0 {
+		return false
+	}
+
+	key := strings.Trim(strings.TrimSpace(m[:end]), `"'`)
+
+	return r.sensitive(key)
+}
+
+// sensitive reports if one of the words of the key is a sensitive name.
+func (r *redactor) sensitive(key string) bool {
+
+	if len(r.fields) == 0 {
+		return false
+	}
+
+	if r.fields[strings.ToLower(key)] {
+		return true
+	}
+
+	for _, word := range splitWords(key) {
+		if r.fields[word] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// field masks the value of a field.
+func (r *redactor) field(f Field) Field {
+
+	if r.sensitive(f.Key) {
+		return Field{Key: f.Key, Value: Redacted}
+	}
+
+	switch v := f.Value.(type) {
+	case nil, int, bool:
+		return f
+	case string:
+		return Field{Key: f.Key, Value: r.message(v)}
+	case error:
+		if s := r.message(v.Error()); s != v.Error() {
+			return Field{Key: f.Key, Value: s}
+		}
+		return f
+	}
+
+	return Field{Key: f.Key, Value: r.value(reflect.ValueOf(f.Value), 0)}
+}
+
+// value returns a copy of v with masked sensitive values, structs are
+// converted to maps.
+func (r *redactor) value(v reflect.Value, depth int) interface{} {
+
+	if !v.IsValid() {
+		return nil
+	}
+
+	if depth > 16 {
+		return fmt.Sprintf("%v", v.Interface())
+	}
+
+	if v.CanInterface() {
+		switch v.Interface().(type) {
+		case json.Marshaler, encoding.TextMarshaler:
+			if !r.sensitiveStruct(v) {
+				return v.Interface()
+			}
+		case error:
+			return r.message(v.Interface().(error).Error())
+		}
+	}
+
+	switch v.Kind() {
+
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return r.value(v.Elem(), depth+1)
+
+	case reflect.String:
+		return r.message(v.String())
+
+	case reflect.Struct:
+
+		t := v.Type()
+		m := make(map[string]interface{}, t.NumField())
+
+		for i := 0; i < t.NumField(); i++ {
+
+			sf := t.Field(i)
+			if sf.PkgPath != "" {
+				continue
+			}
+
+			tag := sf.Tag.Get("log")
+			if tag == "-" {
+				continue
+			}
+
+			name := sf.Name
+			if jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]; jsonName == "-" {
+				continue
+			} else if len(jsonName) > 0 {
+				name = jsonName
+			}
+
+			if tag == "redact" || r.sensitive(name) {
+				m[name] = Redacted
+				continue
+			}
+
+			m[name] = r.value(v.Field(i), depth+1)
+		}
+
+		return m
+
+	case reflect.Map:
+
+		if v.Type().Key().Kind() != reflect.String {
+			return v.Interface()
+		}
+
+		m := make(map[string]interface{}, v.Len())
+
+		iter := v.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			if r.sensitive(key) {
+				m[key] = Redacted
+				continue
+			}
+			m[key] = r.value(iter.Value(), depth+1)
+		}
+
+		return m
+
+	case reflect.Slice, reflect.Array:
+
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+
+		// byte slices are encoded as base64 string, keep them
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface()
+		}
+
+		s := make([]interface{}, v.Len())
+		for i := range s {
+			s[i] = r.value(v.Index(i), depth+1)
+		}
+
+		return s
+	}
+
+	if v.CanInterface() {
+		return v.Interface()
+	}
+
+	return nil
+}
+
+// sensitiveStruct reports if v is a struct with fields which have to be
+// masked, their marshaler would bypass the masking.
+func (r *redactor) sensitiveStruct(v reflect.Value) bool {
+
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return false
+	}
+
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+
+		name := sf.Name
+		if jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]; len(jsonName) > 0 && jsonName != "-" {
+			name = jsonName
+		}
+
+		if sf.Tag.Get("log") == "redact" || r.sensitive(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskGroup masks the first capture group of the match, without capture
+// group the whole match.
+func maskGroup(re *regexp.Regexp, m string) string {
+
+	if re.NumSubexp() == 0 {
+		return Redacted
+	}
+
+	loc := re.FindStringSubmatchIndex(m)
+	if len(loc) < 4 || loc[2] < 0 {
+		return Redacted
+	}
+
+	return m[:loc[2]] + Redacted + m[loc[3]:]
+}
+
+// splitWords splits a key like "api_key", "db.password" or "apiKey" into
+// lower case words.
+func splitWords(key string) []string {
+
+	var words []string
+	var word []rune
+
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	runes := []rune(key)
+	for i, c := range runes {
+		switch {
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			flush()
+		case unicode.IsUpper(c) && i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))):
+			flush()
+			word = append(word, c)
+		default:
+			word = append(word, c)
+		}
+	}
+
+	flush()
+
+	return words
+}
+
+// luhn validates a card number, spaces and dashes are ignored.
+func luhn(s string) bool {
+
+	sum, n := 0, 0
+
+	for i := len(s) - 1; i >= 0; i-- {
+
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		n++
+	}
+
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type account struct {
+	User     string
+	Password string
+	Token    string `log:"redact"`
+}
+
+// MarshalJSON would log the secrets unmasked.
+func (a account) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"user": a.User, "password": a.Password, "token": a.Token})
+}
+
+type version struct {
+	Major, Minor int
+}
+
+func (v version) MarshalText() ([]byte, error) {
+	return []byte("v1.2"), nil
+}
+
+func TestRedactionOptIn(t *testing.T) {
+
+	var out bytes.Buffer
+
+	release := Capture(&out)
+	defer release()
+
+	Info("connect with password=hunter2")
+	With(String("api_key", "abc")).Info("connect")
+
+	if !strings.Contains(out.String(), "hunter2") || !strings.Contains(out.String(), "abc") {
+		t.Fatalf("masked without redaction:\n%s", out.String())
+	}
+
+	// tagged fields are masked anyway
+	out.Reset()
+	With(Any("account", account{User: "bob", Token: "t0k3n"})).Info("connect")
+
+	if strings.Contains(out.String(), "t0k3n") {
+		t.Fatalf("tagged field not masked:\n%s", out.String())
+	}
+
+	// a config without redact section keeps the redaction
+	if err := SetRedaction(DefaultRedaction); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRedaction(Redaction{})
+
+	if err := Configure(Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+	Info("connect with password=hunter2")
+
+	if strings.Contains(out.String(), "hunter2") {
+		t.Fatalf("redaction reset by Configure:\n%s", out.String())
+	}
+}
+
+func TestRedactionMarshaler(t *testing.T) {
+
+	red, err := newRedactor(DefaultRedaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	masked := red.field(Any("account", &account{User: "bob", Password: "hunter2", Token: "t0k3n"}))
+
+	b, err := json.Marshal(masked.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := string(b); strings.Contains(s, "hunter2") || strings.Contains(s, "t0k3n") || !strings.Contains(s, "bob") {
+		t.Fatalf("marshaler bypassed the redaction: %s", s)
+	}
+
+	// without sensitive fields the marshaler is kept
+	kept := red.field(Any("version", version{1, 2}))
+
+	if b, err = json.Marshal(kept.Value); err != nil || string(b) != `"v1.2"` {
+		t.Fatalf("got %s, %v, want the marshaler output", b, err)
+	}
+}
@@ -0,0 +1,286 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Query selects messages by minimum level, component and a substring of
+// the message or the field values, empty values match every message.
+type Query struct {
+	Level     Level
+	Component string
+	Contains  string
+}
+
+// Ring keeps the most recent messages in memory. It implements io.Writer
+// and can be added with AddOutput, the messages can be viewed with the
+// http.Handler returned by Handler.
+type Ring struct {
+	seq         uint64
+	entries     []ringEntry
+	next        int
+	full        bool
+	subscribers map[chan ringEntry]struct{}
+	mu          sync.RWMutex
+}
+
+type ringEntry struct {
+	Entry
+	seq uint64
+	raw []byte
+}
+
+// NewRing returns a ring buffer which keeps the last size messages.
+func NewRing(size int) *Ring {
+
+	if size <= 0 {
+		size = 1000
+	}
+
+	return &Ring{
+		entries:     make([]ringEntry, size),
+		subscribers: make(map[chan ringEntry]struct{}),
+	}
+}
+
+func (r *Ring) Write(p []byte) (int, error) {
+
+	entry, err := DecodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+
+	raw := make([]byte, len(p))
+	copy(raw, p)
+	e := ringEntry{Entry: entry, raw: bytes.TrimSpace(raw)}
+
+	r.mu.Lock()
+
+	r.seq++
+	e.seq = r.seq
+
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+	if r.next == 0 {
+		r.full = true
+	}
+
+	for ch := range r.subscribers {
+		// never block the logger, slow subscribers miss messages
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+
+	r.mu.Unlock()
+
+	return len(p), nil
+}
+
+// Entries returns the kept messages matching the query, oldest first.
+func (r *Ring) Entries(q Query) []Entry {
+
+	var result []Entry
+
+	r.each(q, func(e ringEntry) {
+		result = append(result, e.Entry)
+	})
+
+	return result
+}
+
+func (r *Ring) each(q Query, fn func(e ringEntry)) {
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	start, count := 0, r.next
+	if r.full {
+		start, count = r.next, len(r.entries)
+	}
+
+	for i := 0; i < count; i++ {
+		e := r.entries[(start+i)%len(r.entries)]
+		if q.Match(e.Entry) {
+			fn(e)
+		}
+	}
+}
+
+func (r *Ring) subscribe() chan ringEntry {
+
+	ch := make(chan ringEntry, 256)
+
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+
+	return ch
+}
+
+func (r *Ring) unsubscribe(ch chan ringEntry) {
+	r.mu.Lock()
+	delete(r.subscribers, ch)
+	r.mu.Unlock()
+}
+
+// Match reports if the entry matches the query.
+func (q Query) Match(e Entry) bool {
+
+	if e.Level < q.Level && e.Level != NoLevel {
+		return false
+	}
+
+	if len(q.Component) > 0 && q.Component != e.Component {
+		return false
+	}
+
+	if len(q.Contains) == 0 || strings.Contains(e.Message, q.Contains) {
+		return true
+	}
+
+	for _, v := range e.Fields {
+		if strings.Contains(fieldString(v), q.Contains) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Handler returns a http.Handler to view the kept messages. The query
+// parameters level, component and q filter the messages, limit returns
+// only the last messages. The messages are returned as text, as JSON
+// lines with format=json, follow=1 or an Accept header of
+// text/event-stream tails them as server-sent events.
+func (r *Ring) Handler() http.Handler {
+	return http.HandlerFunc(r.serveHTTP)
+}
+
+func (r *Ring) serveHTTP(w http.ResponseWriter, req *http.Request) {
+
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := req.URL.Query()
+
+	q := Query{
+		Level:     DebugLevel,
+		Component: params.Get("component"),
+		Contains:  params.Get("q"),
+	}
+
+	if lvl := params.Get("level"); len(lvl) > 0 {
+		parsed, err := ParseLevel(lvl)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Level = parsed
+	}
+
+	limit := 0
+	if s := params.Get("limit"); len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	follow := params.Get("follow") == "1" || strings.Contains(req.Header.Get("Accept"), "text/event-stream")
+
+	var ch chan ringEntry
+	if follow {
+		// subscribe before the backlog is read, no message is lost in between
+		ch = r.subscribe()
+		defer r.unsubscribe(ch)
+	}
+
+	var entries []ringEntry
+	r.each(q, func(e ringEntry) {
+		entries = append(entries, e)
+	})
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+
+	if follow {
+		r.tail(w, req, q, ch, entries)
+		return
+	}
+
+	if params.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for _, e := range entries {
+			w.Write(e.raw)
+			w.Write([]byte{'\n'})
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	console := newConsoleWriter(w, true)
+	for _, e := range entries {
+		console.Write(e.raw)
+	}
+}
+
+func (r *Ring) tail(w http.ResponseWriter, req *http.Request, q Query, ch chan ringEntry, backlog []ringEntry) {
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	var last uint64
+	if len(backlog) > 0 {
+		last = backlog[len(backlog)-1].seq
+	}
+
+	for _, e := range backlog {
+		writeEvent(w, e)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+
+		case <-req.Context().Done():
+			return
+
+		case e := <-ch:
+
+			// skip messages already sent with the backlog
+			if e.seq <= last || !q.Match(e.Entry) {
+				continue
+			}
+
+			writeEvent(w, e)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e ringEntry) {
+	// the raw message is a single JSON line, no escaping needed
+	fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.seq, e.raw)
+}
@@ -0,0 +1,300 @@
+package logger
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syslog severities, RFC 5424 section 6.2.1
+const (
+	sevEmergency = iota
+	sevAlert
+	sevCritical
+	sevError
+	sevWarning
+	sevNotice
+	sevInfo
+	sevDebug
+)
+
+// syslog facilities, RFC 5424 section 6.2.1
+const (
+	FacilityKernel = 0
+	FacilityUser   = 1
+	FacilityDaemon = 3
+	FacilityAuth   = 4
+	FacilityLocal0 = 16
+	FacilityLocal1 = 17
+	FacilityLocal2 = 18
+	FacilityLocal3 = 19
+	FacilityLocal4 = 20
+	FacilityLocal5 = 21
+	FacilityLocal6 = 22
+	FacilityLocal7 = 23
+)
+
+// sdID is the structured data id used for the fields, 32473 is the
+// private enterprise number reserved for documentation (RFC 5612).
+const sdID = "fields@32473"
+
+// SyslogConfig configures a syslog output.
+type SyslogConfig struct {
+	Network  string // "unixgram", "udp" or "tcp", defaults to "unixgram"
+	Addr     string // defaults to "/dev/log"
+	Facility int    // defaults to FacilityUser, kernel facility is not usable
+	AppName  string // defaults to the program name
+	Hostname string // defaults to the host name
+}
+
+// Syslog writes messages as RFC 5424 syslog messages. It implements
+// io.Writer and can be added with AddOutput.
+type Syslog struct {
+	config SyslogConfig
+	pid    string
+	conn   net.Conn
+	mu     sync.Mutex
+}
+
+// NewSyslog connects to the syslog server.
+func NewSyslog(config SyslogConfig) (*Syslog, error) {
+
+	if len(config.Network) == 0 {
+		config.Network = "unixgram"
+	}
+
+	if len(config.Addr) == 0 {
+		config.Addr = "/dev/log"
+	}
+
+	if config.Facility == FacilityKernel {
+		config.Facility = FacilityUser
+	}
+
+	if len(config.AppName) == 0 {
+		config.AppName = filepath.Base(os.Args[0])
+	}
+
+	if len(config.Hostname) == 0 {
+		config.Hostname, _ = os.Hostname()
+	}
+
+	s := &Syslog{
+		config: config,
+		pid:    strconv.Itoa(os.Getpid()),
+	}
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Syslog) Write(p []byte) (int, error) {
+
+	entry, err := DecodeEntry(p)
+	if err != nil {
+		return 0, err
+	}
+
+	msg := s.format(entry)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// reconnect once, the syslog daemon may have been restarted
+	if err = s.write(msg); err != nil {
+		if err = s.connect(); err == nil {
+			err = s.write(msg)
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (s *Syslog) Close() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+
+	return err
+}
+
+func (s *Syslog) connect() error {
+
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+
+	conn, err := net.DialTimeout(s.config.Network, s.config.Addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	s.conn = conn
+
+	return nil
+}
+
+func (s *Syslog) write(msg []byte) error {
+
+	if s.conn == nil {
+		return net.ErrClosed
+	}
+
+	// stream transports need framing, octet counting (RFC 6587)
+	if s.config.Network == "tcp" || s.config.Network == "tcp4" || s.config.Network == "tcp6" || s.config.Network == "unix" {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+
+	_, err := s.conn.Write(msg)
+	return err
+}
+
+func (s *Syslog) format(entry Entry) []byte {
+
+	var buf bytes.Buffer
+
+	ts := entry.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	msgID := "-"
+	if len(entry.Component) > 0 {
+		msgID = headerField(entry.Component, 32)
+	}
+
+	buf.WriteByte('<')
+	buf.WriteString(strconv.Itoa(s.config.Facility*8 + severity(entry.Level)))
+	buf.WriteString(">1 ")
+	buf.WriteString(ts.Format("2006-01-02T15:04:05.000000Z07:00"))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(s.config.Hostname, 255))
+	buf.WriteByte(' ')
+	buf.WriteString(headerField(s.config.AppName, 48))
+	buf.WriteByte(' ')
+	buf.WriteString(s.pid)
+	buf.WriteByte(' ')
+	buf.WriteString(msgID)
+	buf.WriteByte(' ')
+
+	fields := entry.Fields
+	if len(entry.Caller) > 0 {
+		fields = make(map[string]interface{}, len(entry.Fields)+1)
+		for k, v := range entry.Fields {
+			fields[k] = v
+		}
+		fields["caller"] = entry.Caller
+	}
+
+	if len(fields) == 0 {
+		buf.WriteByte('-')
+	} else {
+
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('[')
+		buf.WriteString(sdID)
+		for _, key := range keys {
+			buf.WriteByte(' ')
+			buf.WriteString(sdName(key))
+			buf.WriteString(`="`)
+			buf.WriteString(sdEscaper.Replace(fieldString(fields[key])))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+
+	if len(entry.Message) > 0 {
+		buf.WriteByte(' ')
+		buf.WriteString(entry.Message)
+	}
+
+	return buf.Bytes()
+}
+
+// severity maps a level to a syslog severity.
+func severity(lvl Level) int {
+
+	switch lvl {
+	case DebugLevel:
+		return sevDebug
+	case InfoLevel:
+		return sevInfo
+	case WarnLevel:
+		return sevWarning
+	case ErrorLevel:
+		return sevError
+	case FatalLevel:
+		return sevCritical
+	case PanicLevel:
+		return sevAlert
+	}
+
+	return sevNotice
+}
+
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// headerField returns the value as printable US-ASCII without spaces, an
+// empty value is replaced by the nil value "-".
+func headerField(s string, max int) string {
+
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if len(s) > max {
+		s = s[:max]
+	}
+
+	if len(s) == 0 {
+		return "-"
+	}
+
+	return s
+}
+
+// sdName returns a valid SD-NAME, RFC 5424 section 6.3.2
+func sdName(s string) string {
+
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+			return '_'
+		}
+		return r
+	}, s)
+
+	if len(s) > 32 {
+		s = s[:32]
+	}
+
+	return s
+}
@@ -0,0 +1,153 @@
+//go:build unix
+
+package logger
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenUnixgram returns a datagram socket in a temporary directory.
+func listenUnixgram(t *testing.T) *net.UnixConn {
+
+	t.Helper()
+
+	addr := &net.UnixAddr{Name: filepath.Join(t.TempDir(), "sock"), Net: "unixgram"}
+
+	conn, err := net.ListenUnixgram("unixgram", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+// readDatagram reads the next datagram, it fails after a second.
+func readDatagram(t *testing.T, conn *net.UnixConn) string {
+
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	buf := make([]byte, 64<<10)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(buf[:n])
+}
+
+func TestSyslogFraming(t *testing.T) {
+
+	t.Parallel()
+
+	conn := listenUnixgram(t)
+
+	s, err := NewSyslog(SyslogConfig{
+		Addr:     conn.LocalAddr().String(),
+		Facility: FacilityLocal0,
+		AppName:  "app name",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	line := `{"level":"warn","time":"2024-07-21T15:56:49.278492+02:00","component":"db",` +
+		`"caller":"main.go:21","user":"bob","query":"a\"b]c\\d","n":2,"message":"connect failed"}`
+
+	if _, err := s.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readDatagram(t, conn)
+
+	// local0 * 8 + warning
+	want := "<132>1 2024-07-21T15:56:49.278492+02:00 host app_name " + s.pid + " db " +
+		`[fields@32473 caller="main.go:21" n="2" query="a\"b\]c\\d" user="bob"] connect failed`
+
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSyslogNilValues(t *testing.T) {
+
+	t.Parallel()
+
+	conn := listenUnixgram(t)
+
+	s, err := NewSyslog(SyslogConfig{
+		Addr:     conn.LocalAddr().String(),
+		AppName:  "app",
+		Hostname: "host",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	line := `{"level":"error","time":"2024-07-21T15:56:49.278492Z","message":"boom"}`
+
+	if _, err := s.Write([]byte(line)); err != nil {
+		t.Fatal(err)
+	}
+
+	got := readDatagram(t, conn)
+
+	// user * 8 + error, no component and no fields
+	want := "<11>1 2024-07-21T15:56:49.278492Z host app " + s.pid + " - - boom"
+
+	if got != want {
+		t.Fatalf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+
+	tests := []struct {
+		level Level
+		want  int
+	}{
+		{DebugLevel, sevDebug},
+		{InfoLevel, sevInfo},
+		{WarnLevel, sevWarning},
+		{ErrorLevel, sevError},
+		{FatalLevel, sevCritical},
+		{PanicLevel, sevAlert},
+		{NoLevel, sevNotice},
+	}
+
+	for _, test := range tests {
+		if got := severity(test.level); got != test.want {
+			t.Errorf("severity(%s) = %d, want %d", test.level, got, test.want)
+		}
+	}
+}
+
+func TestSyslogHeaderField(t *testing.T) {
+
+	if got := headerField("", 48); got != "-" {
+		t.Errorf("empty field = %q", got)
+	}
+
+	if got := headerField("a b\tc", 48); got != "a_b_c" {
+		t.Errorf("field with spaces = %q", got)
+	}
+
+	if got := headerField(strings.Repeat("x", 50), 48); len(got) != 48 {
+		t.Errorf("field not truncated, length %d", len(got))
+	}
+
+	if got := sdName(`a=b]c"d`); got != "a_b_c_d" {
+		t.Errorf("sd name = %q", got)
+	}
+}
@@ -0,0 +1,280 @@
+package ntp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kernelschmelze/pkg/path"
+)
+
+var (
+	ErrAuthFailed = errors.New("ntp: authentication failed")
+	ErrCryptoNAK  = errors.New("ntp: server rejected the key")
+	ErrUnknownKey = errors.New("ntp: unknown key id")
+)
+
+// Digest types of symmetric keys.
+const (
+	SHA1       = "SHA1"       // SHA1(key || packet), RFC 5905
+	AES128CMAC = "AES128CMAC" // AES-CMAC(key, packet), RFC 8573
+)
+
+const headerSize = 48
+
+// Key is a symmetric key shared with a server.
+type Key struct {
+	ID     uint32
+	Type   string
+	Secret []byte
+}
+
+// Keys maps key ids to keys.
+type Keys map[uint32]*Key
+
+// LoadKeys reads a key file in the format of ntp.keys, one key per line.
+//
+//	# id type  key
+//	1    SHA1  6f7a3bd2e8e09a21bb04fc7d98c41c31a6f36e1c
+//	2    AES128CMAC 00112233445566778899aabbccddeeff
+//	3    SHA1  plaintext
+//
+// Keys up to 20 characters are ascii, longer keys hex encoded.
+func LoadKeys(file string) (Keys, error) {
+
+	keys := make(Keys)
+
+	var lineErr error
+	var lineNo int
+
+	err := utils.ReadLine(file, func(line string) {
+
+		lineNo++
+
+		if lineErr != nil {
+			return
+		}
+
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		if len(fields) < 3 {
+			lineErr = fmt.Errorf("%s:%d: expected id, type and key", file, lineNo)
+			return
+		}
+
+		key, err := ParseKey(fields[0], fields[1], fields[2])
+		if err != nil {
+			lineErr = fmt.Errorf("%s:%d: %s", file, lineNo, err)
+			return
+		}
+
+		keys[key.ID] = key
+	})
+
+	if err == nil {
+		err = lineErr
+	}
+
+	return keys, err
+}
+
+// ParseKey parses the fields of an ntp.keys line.
+func ParseKey(id, typ, secret string) (*Key, error) {
+
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err != nil || n == 0 {
+		return nil, fmt.Errorf("invalid key id %s", id)
+	}
+
+	key := &Key{ID: uint32(n)}
+
+	switch strings.ToUpper(typ) {
+	case "SHA1", "SHA-1":
+		key.Type = SHA1
+	case "AES128CMAC", "AES-128-CMAC", "CMAC":
+		key.Type = AES128CMAC
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", typ)
+	}
+
+	key.Secret = []byte(secret)
+
+	if len(secret) > 20 {
+		if key.Secret, err = hex.DecodeString(secret); err != nil {
+			return nil, fmt.Errorf("invalid hex key %d", n)
+		}
+	}
+
+	if key.Type == AES128CMAC && len(key.Secret) != 16 {
+		return nil, fmt.Errorf("key %d: AES-128-CMAC requires 16 bytes", n)
+	}
+
+	return key, nil
+}
+
+// digest returns the MAC of msg.
+func (k *Key) digest(msg []byte) []byte {
+
+	if k.Type == AES128CMAC {
+		return cmac(k.Secret, msg)
+	}
+
+	h := sha1.New()
+	h.Write(k.Secret)
+	h.Write(msg)
+
+	return h.Sum(nil)
+}
+
+func (k *Key) size() int {
+
+	if k.Type == AES128CMAC {
+		return aes.BlockSize
+	}
+
+	return sha1.Size
+}
+
+func (k *Key) authenticate(req []byte) ([]byte, func([]byte) error, error) {
+	return k.sign(req), k.verify, nil
+}
+
+// sign appends the key id and the MAC to msg.
+func (k *Key) sign(msg []byte) []byte {
+
+	var id [4]byte
+	binary.BigEndian.PutUint32(id[:], k.ID)
+
+	mac := k.digest(msg)
+
+	return append(append(msg, id[:]...), mac...)
+}
+
+// macKeyID returns the key id of the MAC following the header and if the
+// message has a MAC. Longer messages carry extension fields, RFC 7822.
+func macKeyID(msg []byte) (uint32, bool) {
+
+	if len(msg) < headerSize+4 || len(msg) > headerSize+4+sha1.Size {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint32(msg[headerSize:]), true
+}
+
+// verify checks the MAC of msg signed with key.
+func (k *Key) verify(msg []byte) error {
+
+	id, ok := macKeyID(msg)
+	if !ok {
+		return ErrAuthFailed
+	}
+
+	// crypto-NAK, a MAC with key id 0 and without digest
+	if id == 0 && len(msg) == headerSize+4 {
+		return ErrCryptoNAK
+	}
+
+	if id != k.ID || len(msg) != headerSize+4+k.size() {
+		return ErrAuthFailed
+	}
+
+	if !hmac.Equal(msg[headerSize+4:], k.digest(msg[:headerSize])) {
+		return ErrAuthFailed
+	}
+
+	return nil
+}
+
+// cmac computes AES-CMAC, RFC 4493.
+func cmac(key, msg []byte) []byte {
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+
+	return cmacBlock(block, msg)
+}
+
+func cmacBlock(block cipher.Block, msg []byte) []byte {
+
+	k1, k2 := cmacSubkeys(block)
+
+	n := (len(msg) + aes.BlockSize - 1) / aes.BlockSize
+	complete := n > 0 && len(msg)%aes.BlockSize == 0
+	if n == 0 {
+		n = 1
+	}
+
+	last := make([]byte, aes.BlockSize)
+	rest := msg[(n-1)*aes.BlockSize:]
+
+	if complete {
+		xor(last, rest, k1)
+	} else {
+		copy(last, rest)
+		last[len(rest)] = 0x80
+		xor(last, last, k2)
+	}
+
+	x := make([]byte, aes.BlockSize)
+
+	for i := 0; i < n-1; i++ {
+		xor(x, x, msg[i*aes.BlockSize:(i+1)*aes.BlockSize])
+		block.Encrypt(x, x)
+	}
+
+	xor(x, x, last)
+	block.Encrypt(x, x)
+
+	return x
+}
+
+func cmacSubkeys(block cipher.Block) ([]byte, []byte) {
+
+	l := make([]byte, aes.BlockSize)
+	block.Encrypt(l, l)
+
+	k1 := shift(l)
+	k2 := shift(k1)
+
+	return k1, k2
+}
+
+// shift doubles v in GF(2^128).
+func shift(v []byte) []byte {
+
+	out := make([]byte, len(v))
+
+	var carry byte
+	for i := len(v) - 1; i >= 0; i-- {
+		out[i] = v[i]<<1 | carry
+		carry = v[i] >> 7
+	}
+
+	if carry != 0 {
+		out[len(out)-1] ^= 0x87
+	}
+
+	return out
+}
+
+func xor(dst, a, b []byte) {
+	for i := range dst {
+		dst[i] = a[i] ^ b[i]
+	}
+}
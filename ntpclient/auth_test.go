@@ -0,0 +1,188 @@
+package ntp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func unhex(t *testing.T, s string) []byte {
+
+	t.Helper()
+
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestCMAC(t *testing.T) {
+
+	// RFC 4493 section 4
+	key := unhex(t, "2b7e1516 28aed2a6 abf71588 09cf4f3c")
+
+	msg := unhex(t, "6bc1bee2 2e409f96 e93d7e11 7393172a ae2d8a57 1e03ac9c 9eb76fac 45af8e51"+
+		"30c81c46 a35ce411 e5fbc119 1a0a52ef f69f2445 df4f9b17 ad2b417b e66c3710")
+
+	tests := []struct {
+		length int
+		mac    string
+	}{
+		{0, "bb1d6929 e9593728 7fa37d12 9b756746"},
+		{16, "070a16b4 6b4d4144 f79bdd9d d04a287c"},
+		{40, "dfa66747 de9ae630 30ca3261 1497c827"},
+		{64, "51f0bebf 7e3b9d92 fc497417 79363cfe"},
+	}
+
+	for _, test := range tests {
+		if got, want := cmac(key, msg[:test.length]), unhex(t, test.mac); !bytes.Equal(got, want) {
+			t.Errorf("length %d: got %x, want %x", test.length, got, want)
+		}
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "ntp.keys")
+
+	data := `# id type key
+1 SHA1 plaintext
+2 sha-1 6f7a3bd2e8e09a21bb04fc7d98c41c31a6f36e1c   # hex
+3 AES128CMAC 2b7e151628aed2a6abf7158809cf4f3c
+
+`
+
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadKeys(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[uint32]Key{
+		1: {ID: 1, Type: SHA1, Secret: []byte("plaintext")},
+		2: {ID: 2, Type: SHA1, Secret: unhex(t, "6f7a3bd2e8e09a21bb04fc7d98c41c31a6f36e1c")},
+		3: {ID: 3, Type: AES128CMAC, Secret: unhex(t, "2b7e151628aed2a6abf7158809cf4f3c")},
+	}
+
+	if len(keys) != len(want) {
+		t.Fatalf("got %d keys, want %d", len(keys), len(want))
+	}
+
+	for id, w := range want {
+		k, exist := keys[id]
+		if !exist || k.ID != w.ID || k.Type != w.Type || !bytes.Equal(k.Secret, w.Secret) {
+			t.Errorf("key %d is %+v, want %+v", id, k, w)
+		}
+	}
+
+	// errors report the line
+	for _, line := range []string{
+		"0 SHA1 zero",
+		"4 MD5 secret",
+		"5 SHA1",
+		"6 AES128CMAC short",
+		"7 SHA1 not-a-hex-key-of-40-characters-xxxxxx",
+	} {
+
+		if err := os.WriteFile(file, []byte("1 SHA1 plaintext\n"+line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := LoadKeys(file); err == nil || !strings.Contains(err.Error(), ":2:") {
+			t.Errorf("%q: got %v, want an error of line 2", line, err)
+		}
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+
+	sha, err := ParseKey("1", "SHA1", "plaintext")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aes, err := ParseKey("2", "AES128CMAC", "2b7e151628aed2a6abf7158809cf4f3c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make([]byte, headerSize)
+	header[0] = 0x23
+
+	for _, key := range []*Key{sha, aes} {
+
+		msg := key.sign(append([]byte(nil), header...))
+
+		if len(msg) != headerSize+4+key.size() {
+			t.Fatalf("%s: signed message has %d bytes", key.Type, len(msg))
+		}
+
+		if err := key.verify(msg); err != nil {
+			t.Fatalf("%s: %v", key.Type, err)
+		}
+
+		// every modified byte fails the check
+		for i := range msg {
+
+			bad := append([]byte(nil), msg...)
+			bad[i] ^= 1
+
+			if err := key.verify(bad); err != ErrAuthFailed {
+				t.Fatalf("%s: byte %d modified, got %v, want %v", key.Type, i, err, ErrAuthFailed)
+			}
+		}
+
+		// the MAC of the other key
+		other := sha
+		if key == sha {
+			other = aes
+		}
+
+		if err := key.verify(other.sign(append([]byte(nil), header...))); err != ErrAuthFailed {
+			t.Fatalf("%s: got %v for the other key, want %v", key.Type, err, ErrAuthFailed)
+		}
+	}
+
+	if err := sha.verify(cryptoNAK(append([]byte(nil), header...))); err != ErrCryptoNAK {
+		t.Fatalf("got %v, want %v", err, ErrCryptoNAK)
+	}
+}
+
+func TestQueryKey(t *testing.T) {
+
+	key, err := ParseKey("7", "AES128CMAC", "2b7e151628aed2a6abf7158809cf4f3c")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := startServer(t, ServerConfig{Keys: Keys{key.ID: key}, RequireAuth: true}, Faults{})
+
+	ctx := context.Background()
+
+	if _, err := QueryContext(ctx, host, Options{Timeout: time.Second, Key: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	// unauthenticated requests are ignored
+	if _, err := QueryContext(ctx, host, Options{Timeout: 200 * time.Millisecond}); err == nil {
+		t.Fatal("unauthenticated request answered")
+	}
+
+	// a wrong secret is rejected with a crypto-NAK
+	wrong := *key
+	wrong.Secret = bytes.Repeat([]byte{1}, 16)
+
+	if _, err := QueryContext(ctx, host, Options{Timeout: 200 * time.Millisecond, Key: &wrong}); err != ErrCryptoNAK {
+		t.Fatalf("got %v, want %v", err, ErrCryptoNAK)
+	}
+}
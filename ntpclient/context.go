@@ -0,0 +1,233 @@
+package ntp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const defaultHost = "pool.ntp.org"
+
+// Options configure QueryContext.
+type Options struct {
+	// Network is udp, udp4 or udp6, udp uses every resolved address.
+	Network string
+
+	// LocalAddr binds the request to a local address, ip or ip:port.
+	LocalAddr string
+
+	// Dialer replaces the default dialer, LocalAddr overrides its local
+	// address.
+	Dialer *net.Dialer
+
+	// Resolver replaces net.DefaultResolver.
+	Resolver *net.Resolver
+
+	// Timeout limits each address, the context limits the whole query.
+	Timeout time.Duration
+
+	// Key signs the request, the reply has to be signed with the same key.
+	Key *Key
+
+	// NTS authenticates the request with a session established by
+	// DialNTS, it takes precedence over Key.
+	NTS *NTS
+}
+
+// TimeoutError is returned when an address didn't reply in time, before
+// Options.Timeout or the deadline of the context. Err is
+// context.DeadlineExceeded. A cancelled context is returned as ctx.Err().
+type TimeoutError struct {
+	Addr string
+	Err  error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("ntp: %s timed out", e.Addr)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+func (e *TimeoutError) Timeout() bool   { return true }
+func (e *TimeoutError) Temporary() bool { return true }
+
+// QueryContext works like Query, host is resolved and its addresses are
+// tried in turn until one replies. Host defaults to pool.ntp.org:123, the
+// port to 123.
+func QueryContext(ctx context.Context, host string, opt Options) (*Response, error) {
+
+	addrs, err := resolve(ctx, host, opt)
+	if err != nil {
+		return nil, contextError(ctx, host, err)
+	}
+
+	dialer := net.Dialer{}
+	if opt.Dialer != nil {
+		dialer = *opt.Dialer
+	}
+
+	if len(opt.LocalAddr) > 0 {
+		local, err := localAddr(opt.LocalAddr)
+		if err != nil {
+			return nil, err
+		}
+		dialer.LocalAddr = local
+	}
+
+	for _, addr := range addrs {
+
+		var rsp *Response
+
+		rsp, err = queryAddr(ctx, &dialer, addr, opt)
+		if err == nil {
+			return rsp, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, contextError(ctx, addr, err)
+		}
+
+	}
+
+	return nil, err
+}
+
+func queryAddr(ctx context.Context, dialer *net.Dialer, addr string, opt Options) (*Response, error) {
+
+	if timeout := opt.Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, contextError(ctx, addr, err)
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	// unblock the read when the context is cancelled
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Unix(1, 0))
+		case <-done:
+		}
+	}()
+
+	var auth authenticator
+
+	switch {
+	case opt.NTS != nil:
+		auth = opt.NTS
+	case opt.Key != nil:
+		auth = opt.Key
+	}
+
+	rsp, err := exchange(conn, auth)
+	if err != nil {
+		return nil, contextError(ctx, addr, err)
+	}
+
+	return rsp, nil
+}
+
+// contextError returns ctx.Err() if ctx has been cancelled and a
+// TimeoutError if err is caused by an expired deadline, otherwise err.
+func contextError(ctx context.Context, addr string, err error) error {
+
+	if ctx.Err() == context.Canceled {
+		return ctx.Err()
+	}
+
+	if _, ok := err.(*TimeoutError); ok {
+		return err
+	}
+
+	// the deadline of the connection is the deadline of ctx, the read may
+	// time out before ctx.Err() is set
+	if ne, ok := err.(net.Error); (ok && ne.Timeout()) || errors.Is(err, context.DeadlineExceeded) {
+		return &TimeoutError{Addr: addr, Err: context.DeadlineExceeded}
+	}
+
+	return err
+}
+
+// resolve returns the addresses of host matching the network.
+func resolve(ctx context.Context, host string, opt Options) ([]string, error) {
+
+	network := opt.Network
+	if len(network) == 0 {
+		network = "udp"
+	}
+
+	switch network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+
+	if len(host) == 0 {
+		host = defaultHost
+	}
+
+	name, port, err := net.SplitHostPort(host)
+	if err != nil {
+		name, port = host, "123"
+	}
+
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return nil, fmt.Errorf("ntp: invalid port %s", port)
+	}
+
+	resolver := opt.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	ips, err := resolver.LookupIPAddr(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+
+	for _, ip := range ips {
+
+		v4 := ip.IP.To4() != nil
+
+		if (network == "udp4" && !v4) || (network == "udp6" && v4) {
+			continue
+		}
+
+		addrs = append(addrs, net.JoinHostPort(ip.String(), port))
+	}
+
+	if len(addrs) == 0 {
+		return nil, &net.AddrError{Err: "no suitable address found", Addr: host}
+	}
+
+	return addrs, nil
+}
+
+func localAddr(addr string) (*net.UDPAddr, error) {
+
+	if ip := net.ParseIP(addr); ip != nil {
+		return &net.UDPAddr{IP: ip}, nil
+	}
+
+	return net.ResolveUDPAddr("udp", addr)
+}
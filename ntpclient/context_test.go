@@ -0,0 +1,59 @@
+package ntp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// silent returns the address of a socket which never replies.
+func silent(t *testing.T) string {
+
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn.LocalAddr().String()
+}
+
+func TestQueryTimeout(t *testing.T) {
+
+	addr := silent(t)
+
+	// the deadline of the context
+	_, err := Query(addr, 100*time.Millisecond)
+
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || timeout.Addr != addr {
+		t.Fatalf("got %v, want a timeout of %s", err, addr)
+	}
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want it to wrap %v", err, context.DeadlineExceeded)
+	}
+
+	// the timeout of the address
+	_, err = QueryContext(context.Background(), addr, Options{Timeout: 100 * time.Millisecond})
+
+	if ne, ok := err.(net.Error); !errors.As(err, &timeout) || !ok || !ne.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+}
+
+func TestQueryCancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	if _, err := QueryContext(ctx, silent(t), Options{}); err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,451 @@
+// Package drift is a plugin which monitors the offset of the local clock
+// against ntp servers. It is configured by the [drift] section of the
+// plugin configuration.
+//
+//	[drift]
+//	servers      = ["0.pool.ntp.org:123", "1.pool.ntp.org:123", "2.pool.ntp.org:123"]
+//	timeout      = "5s"
+//	interval     = "1m"
+//	max_interval = "1h"
+//	warning      = "100ms"
+//	critical     = "1s"
+//
+// A message with the action "drift" and an Alert payload is dispatched when
+// the severity of the offset changes. Servers answering with the
+// kiss-o'-death codes DENY or RSTR are not queried again until the next
+// configuration, servers answering RATE are paused with a growing interval.
+package drift
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+	"github.com/kernelschmelze/pkg/logger"
+	ntp "github.com/kernelschmelze/pkg/ntpclient"
+	manager "github.com/kernelschmelze/pkg/plugin/manager"
+	base "github.com/kernelschmelze/pkg/plugin/plugin/base"
+)
+
+// Action is the action of the dispatched alerts.
+const Action = "drift"
+
+var log = logger.Named("drift")
+
+type Severity int
+
+const (
+	OK Severity = iota
+	Warning
+	Critical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	}
+	return "ok"
+}
+
+type Config struct {
+	Servers     []string      `toml:"servers"`
+	Timeout     time.Duration `toml:"timeout"`      // per server, defaults to 5s
+	Interval    time.Duration `toml:"interval"`     // defaults to 1m
+	MaxInterval time.Duration `toml:"max_interval"` // defaults to 1h
+	Warning     time.Duration `toml:"warning"`      // defaults to 100ms
+	Critical    time.Duration `toml:"critical"`     // defaults to 1s
+}
+
+// Status is the result of the last poll.
+type Status struct {
+	Offset      time.Duration // add to the local clock to get the ntp time
+	Error       time.Duration // the offset is exact within ± Error
+	Delay       time.Duration // smallest round trip delay of the selected servers
+	Severity    Severity
+	LastSuccess time.Time
+	LastError   error
+	Failures    int // polls failed in a row
+}
+
+// Alert is the payload of the dispatched messages.
+type Alert struct {
+	Severity  Severity
+	Previous  Severity
+	Offset    time.Duration
+	Threshold time.Duration
+}
+
+// kiss is the state of a server which sent a kiss-o'-death.
+type kiss struct {
+	denied bool
+	until  time.Time     // rate limited until
+	wait   time.Duration // current rate limit pause
+}
+
+type Monitor struct {
+	*base.PluginBase
+	config    Config
+	status    Status
+	kissed    map[string]*kiss
+	clock     clock.Clock
+	corrected *clock.Corrected
+	reload    chan struct{}
+	stop      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.RWMutex
+}
+
+// New returns a monitor registered with the plugin manager, it starts to
+// poll with the manager.
+func New() (*Monitor, error) {
+
+	m := &Monitor{
+		PluginBase: base.NewPlugin(),
+		clock:      clock.System,
+		corrected:  clock.NewCorrected(nil),
+		reload:     make(chan struct{}, 1),
+	}
+
+	m.setConfig(Config{})
+
+	err := m.Init(base.PluginConfig{
+		Plugin:      m,
+		OnStart:     m.start,
+		OnStop:      m.shutdown,
+		OnConfigure: m.configure,
+		Config:      &Config{},
+	})
+
+	return m, err
+}
+
+// SetClock sets the clock of the poll interval, the kiss-o'-death pauses
+// and the base of Clock, nil restores the system clock. It has to be
+// called before the monitor is started and Clock is used.
+func (m *Monitor) SetClock(c clock.Clock) {
+
+	if c == nil {
+		c = clock.System
+	}
+
+	m.clock = c
+	m.corrected = clock.NewCorrected(c)
+}
+
+// Clock returns the clock set by SetClock corrected by the last measured
+// offset.
+//
+//	logger.SetClock(m.Clock())
+func (m *Monitor) Clock() clock.Clock {
+	return m.corrected
+}
+
+// Status returns the result of the last poll.
+func (m *Monitor) Status() Status {
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.status
+}
+
+func (m *Monitor) configure(v interface{}) {
+
+	cfg, ok := v.(*Config)
+	if !ok {
+		return
+	}
+
+	m.setConfig(*cfg)
+
+	select {
+	case m.reload <- struct{}{}:
+	default:
+	}
+
+}
+
+func (m *Monitor) setConfig(cfg Config) {
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+
+	if cfg.MaxInterval <= 0 {
+		cfg.MaxInterval = time.Hour
+	}
+
+	if cfg.MaxInterval < cfg.Interval {
+		cfg.MaxInterval = cfg.Interval
+	}
+
+	if cfg.Warning <= 0 {
+		cfg.Warning = 100 * time.Millisecond
+	}
+
+	if cfg.Critical <= 0 {
+		cfg.Critical = time.Second
+	}
+
+	m.mu.Lock()
+	m.config = cfg
+	m.kissed = make(map[string]*kiss)
+	m.mu.Unlock()
+
+}
+
+func (m *Monitor) start() error {
+
+	m.stop = make(chan struct{})
+
+	m.wg.Add(1)
+	go m.run(m.stop)
+
+	return nil
+}
+
+func (m *Monitor) shutdown() error {
+
+	close(m.stop)
+	m.wg.Wait()
+
+	return nil
+}
+
+func (m *Monitor) run(stop chan struct{}) {
+
+	defer m.wg.Done()
+
+	var wait time.Duration
+
+	timer := m.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+
+		select {
+
+		case <-stop:
+			return
+
+		case <-m.reload:
+			wait = 0
+
+		case <-timer.C():
+
+		}
+
+		wait = m.poll(wait)
+
+		timer.Reset(jitter(wait))
+
+	}
+
+}
+
+// poll queries the servers and returns the time until the next poll. The
+// interval doubles while the clock is in sync and on errors, it is reset
+// when the offset exceeds a threshold.
+func (m *Monitor) poll(interval time.Duration) time.Duration {
+
+	m.mu.RLock()
+	cfg := m.config
+	servers := m.servers(cfg, m.clock.Now())
+	m.mu.RUnlock()
+
+	if len(cfg.Servers) == 0 {
+		return cfg.Interval
+	}
+
+	if len(servers) == 0 {
+		log.Warnf("all %d servers sent a kiss-o'-death", len(cfg.Servers))
+		return backoff(interval, cfg)
+	}
+
+	est, err := ntp.QueryServers(servers, cfg.Timeout)
+
+	m.mu.Lock()
+
+	m.kiss(est, cfg, m.clock.Now())
+
+	if err != nil {
+
+		m.status.LastError = err
+		m.status.Failures++
+
+		m.mu.Unlock()
+
+		log.Warnf("poll %d servers failed: %s", len(cfg.Servers), err)
+
+		return backoff(interval, cfg)
+	}
+
+	for host, err := range est.Errors {
+		log.Debugf("query %s failed: %s", host, err)
+	}
+
+	if len(est.Falsetickers) > 0 {
+		log.Warnf("discarded falsetickers %v", est.Falsetickers)
+	}
+
+	previous := m.status.Severity
+
+	m.status = Status{
+		Offset:      est.ClockOffset,
+		Error:       est.Error,
+		Delay:       minDelay(est),
+		Severity:    severity(est.ClockOffset, cfg),
+		LastSuccess: m.clock.Now(),
+	}
+
+	status := m.status
+
+	m.mu.Unlock()
+
+	m.corrected.SetOffset(status.Offset)
+
+	log.Debugf("offset %s ± %s, delay %s", status.Offset, status.Error, status.Delay)
+
+	if status.Severity != previous {
+		m.alert(status, previous, cfg)
+	}
+
+	if status.Severity != OK {
+		return cfg.Interval
+	}
+
+	return backoff(interval, cfg)
+}
+
+// servers returns the servers which may be queried, the lock must be held.
+func (m *Monitor) servers(cfg Config, now time.Time) []string {
+
+	servers := make([]string, 0, len(cfg.Servers))
+
+	for _, host := range cfg.Servers {
+		if k, exist := m.kissed[host]; exist && (k.denied || now.Before(k.until)) {
+			continue
+		}
+		servers = append(servers, host)
+	}
+
+	return servers
+}
+
+// kiss drops the servers which denied access and pauses the rate limited
+// ones, the lock must be held.
+func (m *Monitor) kiss(est *ntp.Estimate, cfg Config, now time.Time) {
+
+	for host := range est.Responses {
+		delete(m.kissed, host)
+	}
+
+	for host, err := range est.Errors {
+
+		kod, ok := err.(*ntp.KissOfDeathError)
+		if !ok || !(kod.Denied() || kod.RateExceeded()) {
+			continue
+		}
+
+		k, exist := m.kissed[host]
+		if !exist {
+			k = &kiss{}
+			m.kissed[host] = k
+		}
+
+		switch {
+		case kod.Denied():
+			k.denied = true
+			log.Warnf("server %s denied access (%s), dropped until the next configuration", host, kod.Code)
+		case kod.RateExceeded():
+			k.wait = backoff(k.wait, cfg)
+			k.until = now.Add(k.wait)
+			log.Warnf("server %s rate limited, paused for %s", host, k.wait)
+		}
+	}
+}
+
+func (m *Monitor) alert(status Status, previous Severity, cfg Config) {
+
+	alert := Alert{
+		Severity: status.Severity,
+		Previous: previous,
+		Offset:   status.Offset,
+	}
+
+	switch status.Severity {
+	case Warning:
+		alert.Threshold = cfg.Warning
+		log.Warnf("clock offset %s exceeds %s", status.Offset, cfg.Warning)
+	case Critical:
+		alert.Threshold = cfg.Critical
+		log.Errorf("clock offset %s exceeds %s", status.Offset, cfg.Critical)
+	default:
+		log.Infof("clock offset %s recovered", status.Offset)
+	}
+
+	manager.Dispatch(manager.NewMessage(Action, alert))
+
+}
+
+func severity(offset time.Duration, cfg Config) Severity {
+
+	if offset < 0 {
+		offset = -offset
+	}
+
+	switch {
+	case offset >= cfg.Critical:
+		return Critical
+	case offset >= cfg.Warning:
+		return Warning
+	}
+
+	return OK
+}
+
+func minDelay(est *ntp.Estimate) time.Duration {
+
+	var delay time.Duration
+
+	for i, host := range est.Survivors {
+		if rtt := est.Responses[host].RTT; i == 0 || rtt < delay {
+			delay = rtt
+		}
+	}
+
+	return delay
+}
+
+func backoff(interval time.Duration, cfg Config) time.Duration {
+
+	interval *= 2
+
+	if interval < cfg.Interval {
+		interval = cfg.Interval
+	}
+
+	if interval > cfg.MaxInterval {
+		interval = cfg.MaxInterval
+	}
+
+	return interval
+}
+
+// jitter spreads the polls of several hosts by ±10%.
+func jitter(d time.Duration) time.Duration {
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d + time.Duration(rand.Int63n(int64(d)/5+1)) - d/10
+}
@@ -0,0 +1,308 @@
+package drift
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+	ntp "github.com/kernelschmelze/pkg/ntpclient"
+	manager "github.com/kernelschmelze/pkg/plugin/manager"
+	base "github.com/kernelschmelze/pkg/plugin/plugin/base"
+)
+
+// startServer starts a local ntp server with the faults, it is stopped
+// when the test has finished.
+func startServer(t *testing.T, faults ntp.Faults) (*ntp.Server, string) {
+
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ntp.NewServer(ntp.ServerConfig{})
+	s.SetFaults(faults)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		s.Serve(ctx, conn)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return s, conn.LocalAddr().String()
+}
+
+// newMonitor returns a monitor which isn't registered with the manager.
+func newMonitor(fake *clock.Fake, servers ...string) *Monitor {
+
+	m := &Monitor{
+		PluginBase: base.NewPlugin(),
+		reload:     make(chan struct{}, 1),
+	}
+
+	m.SetClock(fake)
+	m.setConfig(Config{
+		Servers:     servers,
+		Timeout:     200 * time.Millisecond,
+		Interval:    time.Minute,
+		MaxInterval: 4 * time.Minute,
+	})
+
+	return m
+}
+
+var (
+	alerts     = make(chan Alert, 8)
+	alertsOnce sync.Once
+)
+
+// receiveAlerts starts the manager with a plugin receiving the alerts.
+func receiveAlerts(t *testing.T) {
+
+	alertsOnce.Do(func() {
+
+		p := base.NewPlugin()
+		p.RegisterActionCallback(Action, func(v interface{}) error {
+			alerts <- v.(Alert)
+			return nil
+		})
+
+		m := manager.GetManager()
+		if err := m.AddPlugin(p); err != nil {
+			t.Fatal(err)
+		}
+
+		m.Start()
+	})
+}
+
+func nextAlert(t *testing.T) Alert {
+
+	t.Helper()
+
+	select {
+	case a := <-alerts:
+		return a
+	case <-time.After(2 * time.Second):
+		t.Fatal("no alert dispatched")
+	}
+
+	return Alert{}
+}
+
+func TestPollBackoff(t *testing.T) {
+
+	_, a := startServer(t, ntp.Faults{})
+	_, b := startServer(t, ntp.Faults{})
+	_, c := startServer(t, ntp.Faults{})
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+	m := newMonitor(fake, a, b, c)
+
+	// in sync, the interval doubles up to the maximum
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute} {
+
+		wait := m.poll(want / 2)
+
+		if wait != want {
+			t.Fatalf("got %s, want %s", wait, want)
+		}
+	}
+
+	if status := m.Status(); !status.LastSuccess.Equal(fake.Now()) || status.Failures != 0 {
+		t.Fatalf("got %+v, want a success at %s", status, fake.Now())
+	}
+
+	// no server replies, the failures back off, too
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	m.setConfig(Config{
+		Servers:     []string{silent.LocalAddr().String()},
+		Timeout:     100 * time.Millisecond,
+		Interval:    time.Minute,
+		MaxInterval: 4 * time.Minute,
+	})
+
+	if wait := m.poll(0); wait != time.Minute {
+		t.Fatalf("got %s after a failure, want %s", wait, time.Minute)
+	}
+
+	if wait := m.poll(time.Minute); wait != 2*time.Minute {
+		t.Fatalf("got %s after two failures, want %s", wait, 2*time.Minute)
+	}
+
+	if status := m.Status(); status.Failures != 2 || status.LastError == nil {
+		t.Fatalf("got %+v, want 2 failures", status)
+	}
+}
+
+func TestKissOfDeath(t *testing.T) {
+
+	_, good1 := startServer(t, ntp.Faults{})
+	_, good2 := startServer(t, ntp.Faults{})
+	_, deny := startServer(t, ntp.Faults{Kiss: ntp.KissDeny})
+	rateServer, rate := startServer(t, ntp.Faults{Kiss: ntp.KissRate})
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+	m := newMonitor(fake, good1, good2, deny, rate)
+
+	queried := func(want ...string) {
+
+		t.Helper()
+
+		got := m.servers(m.config, fake.Now())
+
+		sort.Strings(got)
+		sort.Strings(want)
+
+		if len(got) != len(want) {
+			t.Fatalf("queried %v, want %v", got, want)
+		}
+
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("queried %v, want %v", got, want)
+			}
+		}
+	}
+
+	m.poll(0)
+
+	// denied until the next configuration, rate limited for an interval
+	queried(good1, good2)
+
+	fake.Advance(time.Minute)
+	queried(good1, good2, rate)
+
+	// rate limited again, the pause doubles
+	m.poll(0)
+
+	fake.Advance(time.Minute)
+	queried(good1, good2)
+
+	fake.Advance(time.Minute)
+	queried(good1, good2, rate)
+
+	// the reply of the server ends the pause
+	rateServer.SetFaults(ntp.Faults{})
+	m.poll(0)
+
+	if _, exist := m.kissed[rate]; exist {
+		t.Fatal("rate limit kept after a reply")
+	}
+
+	queried(good1, good2, rate)
+
+	m.setConfig(m.config)
+	queried(good1, good2, deny, rate)
+}
+
+func TestAlert(t *testing.T) {
+
+	receiveAlerts(t)
+
+	var servers []*ntp.Server
+	var hosts []string
+
+	for i := 0; i < 3; i++ {
+		s, host := startServer(t, ntp.Faults{Skew: 2 * time.Second})
+		servers = append(servers, s)
+		hosts = append(hosts, host)
+	}
+
+	skew := func(d time.Duration) {
+		for _, s := range servers {
+			s.SetFaults(ntp.Faults{Skew: d})
+		}
+	}
+
+	fake := clock.NewFake(time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC))
+	m := newMonitor(fake, hosts...)
+
+	// not in sync, polled with the shortest interval
+	if wait := m.poll(4 * time.Minute); wait != time.Minute {
+		t.Fatalf("got %s, want %s", wait, time.Minute)
+	}
+
+	if a := nextAlert(t); a.Severity != Critical || a.Previous != OK || a.Threshold != time.Second {
+		t.Fatalf("got %+v, want a critical alert", a)
+	}
+
+	// the corrected clock is based on the injected clock
+	if d := m.Clock().Now().Sub(fake.Now()) - 2*time.Second; d < -50*time.Millisecond || d > 50*time.Millisecond {
+		t.Fatalf("corrected clock is off by %s", d)
+	}
+
+	skew(150 * time.Millisecond)
+	m.poll(0)
+
+	if a := nextAlert(t); a.Severity != Warning || a.Previous != Critical || a.Threshold != 100*time.Millisecond {
+		t.Fatalf("got %+v, want a warning", a)
+	}
+
+	skew(0)
+	m.poll(0)
+
+	if a := nextAlert(t); a.Severity != OK || a.Previous != Warning {
+		t.Fatalf("got %+v, want a recovery", a)
+	}
+
+	// the severity didn't change
+	m.poll(0)
+
+	select {
+	case a := <-alerts:
+		t.Fatalf("unexpected alert %+v", a)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRunClock(t *testing.T) {
+
+	_, a := startServer(t, ntp.Faults{})
+	_, b := startServer(t, ntp.Faults{})
+	_, c := startServer(t, ntp.Faults{})
+
+	start := time.Date(2024, 7, 21, 15, 56, 49, 0, time.UTC)
+	fake := clock.NewFake(start)
+	m := newMonitor(fake, a, b, c)
+
+	polled := func(at time.Time) {
+
+		t.Helper()
+
+		deadline := time.Now().Add(2 * time.Second)
+
+		for !m.Status().LastSuccess.Equal(at) || fake.Timers() != 1 {
+			if time.Now().After(deadline) {
+				t.Fatalf("no poll at %s, got %+v", at, m.Status())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	m.start()
+	defer m.shutdown()
+
+	// the first poll is immediate, the next one waits for the clock
+	polled(start)
+
+	fake.Advance(2 * time.Minute)
+	polled(start.Add(2 * time.Minute))
+}
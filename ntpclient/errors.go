@@ -0,0 +1,68 @@
+package ntp
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrShortPacket       = errors.New("ntp: short packet")
+	ErrInvalidMode       = errors.New("ntp: invalid mode")
+	ErrInvalidStratum    = errors.New("ntp: invalid stratum")
+	ErrInvalidTransmit   = errors.New("ntp: invalid transmit time")
+	ErrNotSynchronized   = errors.New("ntp: server not synchronized")
+	ErrInvalidTimestamps = errors.New("ntp: server transmit before receive")
+)
+
+// Kiss-o'-death codes, RFC 5905 section 7.4.
+const (
+	KissAcst = "ACST" // the association belongs to a unicast server
+	KissAuth = "AUTH" // server authentication failed
+	KissAuto = "AUTO" // autokey sequence failed
+	KissBcst = "BCST" // the association belongs to a broadcast server
+	KissCryp = "CRYP" // cryptographic authentication or identification failed
+	KissDeny = "DENY" // access denied by remote server
+	KissDrop = "DROP" // lost peer in symmetric mode
+	KissRstr = "RSTR" // access denied due to local policy
+	KissInit = "INIT" // the association has not yet synchronized for the first time
+	KissMcst = "MCST" // the association belongs to a dynamically discovered server
+	KissNkey = "NKEY" // no key found
+	KissNtsn = "NTSN" // network time security negative acknowledgment, RFC 8915
+	KissRate = "RATE" // rate exceeded, the server has temporarily denied access
+	KissRmot = "RMOT" // alteration of association from a remote host
+	KissStep = "STEP" // a step change in system time has occurred
+)
+
+// KissOfDeathError is returned for a reply with stratum 0, the server asks
+// the client to back off or stop querying.
+type KissOfDeathError struct {
+	Code string
+}
+
+func (e *KissOfDeathError) Error() string {
+	return fmt.Sprintf("ntp: kiss of death %s", e.Code)
+}
+
+// RateExceeded reports if the client should reduce its poll rate.
+func (e *KissOfDeathError) RateExceeded() bool {
+	return e.Code == KissRate
+}
+
+// Denied reports if the client must stop querying the server.
+func (e *KissOfDeathError) Denied() bool {
+	return e.Code == KissDeny || e.Code == KissRstr
+}
+
+func kissCode(refID uint32) string {
+
+	code := []byte{byte(refID >> 24), byte(refID >> 16), byte(refID >> 8), byte(refID)}
+
+	for i, c := range code {
+		if c < 0x20 || c > 0x7e {
+			code = code[:i]
+			break
+		}
+	}
+
+	return string(code)
+}
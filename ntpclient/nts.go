@@ -0,0 +1,527 @@
+package ntp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Network Time Security, RFC 8915. The key establishment runs over TLS and
+// negotiates the keys and cookies, the ntp requests carry a cookie and are
+// authenticated with AEAD_AES_SIV_CMAC_256 in extension fields.
+
+const (
+	ntsALPN     = "ntske/1"
+	ntsPort     = "4460"
+	ntsExporter = "EXPORTER-network-time-security"
+	ntsCookies  = 8
+)
+
+// NTS-KE record types.
+const (
+	keEnd          = 0
+	keNextProtocol = 1
+	keError        = 2
+	keWarning      = 3
+	keAEAD         = 4
+	keCookie       = 5
+	keServer       = 6
+	kePort         = 7
+)
+
+// NTS extension field types.
+const (
+	efUniqueID          = 0x0104
+	efCookie            = 0x0204
+	efCookiePlaceholder = 0x0304
+	efAuthenticator     = 0x0404
+)
+
+var (
+	ErrNoCookies   = errors.New("ntp: no nts cookies left")
+	ErrNTSProtocol = errors.New("ntp: nts-ke negotiation failed")
+)
+
+// NTSKEError is an error record sent by the NTS-KE server.
+type NTSKEError struct {
+	Code uint16
+}
+
+func (e *NTSKEError) Error() string {
+
+	switch e.Code {
+	case 0:
+		return "ntp: nts-ke unrecognized critical record"
+	case 1:
+		return "ntp: nts-ke bad request"
+	case 2:
+		return "ntp: nts-ke internal server error"
+	}
+
+	return fmt.Sprintf("ntp: nts-ke error %d", e.Code)
+}
+
+// NTS is a session with an NTS server, the keys and cookies of the session
+// authenticate the ntp requests. It is safe for concurrent use.
+type NTS struct {
+	host    string
+	config  *tls.Config
+	server  string
+	c2s     []byte
+	s2c     []byte
+	cookies [][]byte
+	mu      sync.Mutex
+}
+
+// DialNTS runs the key establishment with host, the port defaults to 4460.
+// A nil config uses the system roots.
+func DialNTS(ctx context.Context, host string, config *tls.Config) (*NTS, error) {
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, ntsPort)
+	}
+
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	n := &NTS{
+		host:   host,
+		config: config,
+	}
+
+	if err := n.keyExchange(ctx); err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Server returns the ntp server negotiated by the key establishment.
+func (n *NTS) Server() string {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.server
+}
+
+// Query queries the negotiated ntp server. The key establishment is run
+// again when the cookies are used up or the server rejected them.
+func (n *NTS) Query(ctx context.Context, opt Options) (*Response, error) {
+
+	n.mu.Lock()
+	empty := len(n.cookies) == 0
+	n.mu.Unlock()
+
+	if empty {
+		if err := n.keyExchange(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	opt.NTS = n
+
+	rsp, err := QueryContext(ctx, n.Server(), opt)
+
+	// only the negative acknowledgment arrived, the session needs new keys
+	if kod, ok := err.(*KissOfDeathError); ok && kod.Code == KissNtsn {
+		n.mu.Lock()
+		n.cookies = nil
+		n.mu.Unlock()
+	}
+
+	return rsp, err
+}
+
+func (n *NTS) keyExchange(ctx context.Context) error {
+
+	name, _, _ := net.SplitHostPort(n.host)
+
+	config := n.config.Clone()
+	config.NextProtos = []string{ntsALPN}
+	config.MinVersion = tls.VersionTLS13
+
+	if len(config.ServerName) == 0 {
+		config.ServerName = name
+	}
+
+	dialer := tls.Dialer{Config: config}
+
+	conn, err := dialer.DialContext(ctx, "tcp", n.host)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	tc := conn.(*tls.Conn)
+
+	var req []byte
+	req = appendRecord(req, true, keNextProtocol, uint16s(0))
+	req = appendRecord(req, true, keAEAD, uint16s(sivAlgorithm))
+	req = appendRecord(req, true, keEnd, nil)
+
+	if _, err := tc.Write(req); err != nil {
+		return err
+	}
+
+	records, err := readRecords(bufio.NewReader(tc))
+	if err != nil {
+		return err
+	}
+
+	server, port := name, "123"
+	var cookies [][]byte
+	var protocol, aead bool
+
+	for _, r := range records {
+
+		switch r.typ {
+
+		case keError:
+			code := uint16(0xffff)
+			if len(r.body) >= 2 {
+				code = binary.BigEndian.Uint16(r.body)
+			}
+			return &NTSKEError{Code: code}
+
+		case keNextProtocol:
+			protocol = len(r.body) == 2 && binary.BigEndian.Uint16(r.body) == 0
+
+		case keAEAD:
+			aead = len(r.body) == 2 && binary.BigEndian.Uint16(r.body) == sivAlgorithm
+
+		case keCookie:
+			cookies = append(cookies, r.body)
+
+		case keServer:
+			server = string(r.body)
+
+		case kePort:
+			if len(r.body) == 2 {
+				port = strconv.Itoa(int(binary.BigEndian.Uint16(r.body)))
+			}
+
+		case keWarning, keEnd:
+
+		default:
+			if r.critical {
+				return ErrNTSProtocol
+			}
+
+		}
+
+	}
+
+	if !protocol || !aead || len(cookies) == 0 {
+		return ErrNTSProtocol
+	}
+
+	c2s, s2c, err := ntsKeys(tc.ConnectionState())
+	if err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.server = net.JoinHostPort(server, port)
+	n.c2s, n.s2c = c2s, s2c
+	n.cookies = cookies
+	n.mu.Unlock()
+
+	return nil
+}
+
+// ntsKeys exports the client to server and server to client keys.
+func ntsKeys(state tls.ConnectionState) ([]byte, []byte, error) {
+
+	context := []byte{0, 0, 0, sivAlgorithm, 0}
+
+	c2s, err := state.ExportKeyingMaterial(ntsExporter, context, sivKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	context[4] = 1
+
+	s2c, err := state.ExportKeyingMaterial(ntsExporter, context, sivKeySize)
+
+	return c2s, s2c, err
+}
+
+// authenticate appends the unique id, a cookie, placeholders to refill the
+// cookies and the authenticator to req.
+func (n *NTS) authenticate(req []byte) ([]byte, func([]byte) error, error) {
+
+	n.mu.Lock()
+
+	if len(n.cookies) == 0 {
+		n.mu.Unlock()
+		return nil, nil, ErrNoCookies
+	}
+
+	cookie := n.cookies[0]
+	n.cookies = n.cookies[1:]
+	placeholders := ntsCookies - 1 - len(n.cookies)
+	c2s, s2c := n.c2s, n.s2c
+
+	n.mu.Unlock()
+
+	uid := make([]byte, 32)
+	nonce := make([]byte, 16)
+
+	if _, err := rand.Read(uid); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	req = appendExtension(req, efUniqueID, uid)
+	req = appendExtension(req, efCookie, cookie)
+
+	for i := 0; i < placeholders; i++ {
+		req = appendExtension(req, efCookiePlaceholder, make([]byte, len(cookie)))
+	}
+
+	sealed, err := sivSeal(c2s, nil, req, nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req = appendExtension(req, efAuthenticator, authenticatorBody(nonce, sealed))
+
+	verify := func(rsp []byte) error {
+		return n.verify(rsp, uid, s2c)
+	}
+
+	return req, verify, nil
+}
+
+// verify checks the unique id and the authenticator of a reply and stores
+// the new cookies.
+func (n *NTS) verify(rsp, uid, s2c []byte) error {
+
+	fields, err := parseExtensions(rsp)
+	if err != nil {
+		return err
+	}
+
+	var echoed bool
+
+	for _, f := range fields {
+
+		switch f.typ {
+
+		case efUniqueID:
+			echoed = bytes.Equal(f.body, uid)
+
+		case efAuthenticator:
+
+			if !echoed {
+				return ErrAuthFailed
+			}
+
+			nonce, sealed, err := parseAuthenticator(f.body)
+			if err != nil {
+				return err
+			}
+
+			plaintext, err := sivOpen(s2c, sealed, rsp[:f.offset], nonce)
+			if err != nil {
+				return err
+			}
+
+			inner, err := parseFields(plaintext, 0)
+			if err != nil {
+				return err
+			}
+
+			n.mu.Lock()
+			for _, c := range inner {
+				if c.typ == efCookie && len(n.cookies) < ntsCookies {
+					n.cookies = append(n.cookies, c.body)
+				}
+			}
+			n.mu.Unlock()
+
+			return nil
+
+		}
+
+	}
+
+	// the kiss-o'-death NTSN is not authenticated, the server couldn't
+	// decrypt the cookie, Query discards the session if no authenticated
+	// reply arrives
+	if echoed && rsp[1] == 0 && kissCode(binary.BigEndian.Uint32(rsp[12:])) == KissNtsn {
+		return &KissOfDeathError{Code: KissNtsn}
+	}
+
+	return ErrAuthFailed
+}
+
+type record struct {
+	critical bool
+	typ      uint16
+	body     []byte
+}
+
+func appendRecord(b []byte, critical bool, typ uint16, body []byte) []byte {
+
+	if critical {
+		typ |= 0x8000
+	}
+
+	var head [4]byte
+	binary.BigEndian.PutUint16(head[:], typ)
+	binary.BigEndian.PutUint16(head[2:], uint16(len(body)))
+
+	return append(append(b, head[:]...), body...)
+}
+
+// readRecords reads the records up to end of message.
+func readRecords(r io.Reader) ([]record, error) {
+
+	var records []record
+
+	for len(records) < 1024 {
+
+		var head [4]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, err
+		}
+
+		typ := binary.BigEndian.Uint16(head[:])
+
+		rec := record{
+			critical: typ&0x8000 != 0,
+			typ:      typ & 0x7fff,
+			body:     make([]byte, binary.BigEndian.Uint16(head[2:])),
+		}
+
+		if _, err := io.ReadFull(r, rec.body); err != nil {
+			return nil, err
+		}
+
+		if rec.typ == keEnd {
+			return records, nil
+		}
+
+		records = append(records, rec)
+	}
+
+	return nil, ErrNTSProtocol
+}
+
+func uint16s(v ...uint16) []byte {
+
+	b := make([]byte, 2*len(v))
+	for i := range v {
+		binary.BigEndian.PutUint16(b[2*i:], v[i])
+	}
+
+	return b
+}
+
+type extension struct {
+	typ    uint16
+	body   []byte
+	offset int // offset of the field in the message
+}
+
+// appendExtension appends an extension field, the body is padded to a
+// multiple of 4 and the field to at least 16 bytes, RFC 7822.
+func appendExtension(b []byte, typ uint16, body []byte) []byte {
+
+	size := 4 + (len(body)+3)&^3
+	if size < 16 {
+		size = 16
+	}
+
+	field := make([]byte, size)
+	binary.BigEndian.PutUint16(field, typ)
+	binary.BigEndian.PutUint16(field[2:], uint16(size))
+	copy(field[4:], body)
+
+	return append(b, field...)
+}
+
+// parseExtensions returns the extension fields following the header.
+func parseExtensions(msg []byte) ([]extension, error) {
+
+	if len(msg) < headerSize {
+		return nil, ErrShortPacket
+	}
+
+	return parseFields(msg, headerSize)
+}
+
+func parseFields(msg []byte, offset int) ([]extension, error) {
+
+	var fields []extension
+
+	for offset+4 <= len(msg) {
+
+		typ := binary.BigEndian.Uint16(msg[offset:])
+		size := int(binary.BigEndian.Uint16(msg[offset+2:]))
+
+		if size < 4 || size%4 != 0 || offset+size > len(msg) {
+			return nil, ErrAuthFailed
+		}
+
+		fields = append(fields, extension{
+			typ:    typ,
+			body:   msg[offset+4 : offset+size],
+			offset: offset,
+		})
+
+		offset += size
+	}
+
+	return fields, nil
+}
+
+func authenticatorBody(nonce, sealed []byte) []byte {
+
+	pad := func(n int) int { return (n + 3) &^ 3 }
+
+	body := make([]byte, 4+pad(len(nonce))+pad(len(sealed)))
+	binary.BigEndian.PutUint16(body, uint16(len(nonce)))
+	binary.BigEndian.PutUint16(body[2:], uint16(len(sealed)))
+	copy(body[4:], nonce)
+	copy(body[4+pad(len(nonce)):], sealed)
+
+	return body
+}
+
+func parseAuthenticator(body []byte) ([]byte, []byte, error) {
+
+	if len(body) < 4 {
+		return nil, nil, ErrAuthFailed
+	}
+
+	nonceLen := int(binary.BigEndian.Uint16(body))
+	sealedLen := int(binary.BigEndian.Uint16(body[2:]))
+	start := 4 + (nonceLen+3)&^3
+
+	if start+sealedLen > len(body) {
+		return nil, nil, ErrAuthFailed
+	}
+
+	return body[4 : 4+nonceLen], body[start : start+sealedLen], nil
+}
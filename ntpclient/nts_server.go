@@ -0,0 +1,346 @@
+package ntp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ntsTimeout limits a key establishment.
+const ntsTimeout = 10 * time.Second
+
+var errInvalidCookie = errors.New("ntp: invalid nts cookie")
+
+// NTSKEConfig configures an NTS-KE server.
+type NTSKEConfig struct {
+	Addr   string      // defaults to :4460
+	TLS    *tls.Config // certificate of the server
+	Key    []byte      // cookie key shared with ServerConfig.NTSKey, see NewNTSKey
+	Server string      // ntp server announced to the clients, empty for this host
+	Port   uint16      // ntp port announced to the clients, 0 for 123
+}
+
+// NTSKEServer runs the NTS key establishment for Server.
+type NTSKEServer struct {
+	config NTSKEConfig
+	ln     net.Listener
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+}
+
+// NewNTSKey returns a random cookie key.
+func NewNTSKey() ([]byte, error) {
+
+	key := make([]byte, sivKeySize)
+	_, err := rand.Read(key)
+
+	return key, err
+}
+
+func NewNTSKEServer(config NTSKEConfig) *NTSKEServer {
+
+	if len(config.Addr) == 0 {
+		config.Addr = ":" + ntsPort
+	}
+
+	return &NTSKEServer{config: config}
+}
+
+// Addr returns the address the server listens on, nil before it listens.
+func (s *NTSKEServer) Addr() net.Addr {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.ln == nil {
+		return nil
+	}
+
+	return s.ln.Addr()
+}
+
+// ListenAndServe listens on the configured address and serves the key
+// establishment until ctx is done.
+func (s *NTSKEServer) ListenAndServe(ctx context.Context) error {
+
+	ln, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on ln until ctx is done, ln is closed on
+// return. Serve returns after the pending connections have finished.
+func (s *NTSKEServer) Serve(ctx context.Context, ln net.Listener) error {
+
+	if s.config.TLS == nil || len(s.config.Key) != sivKeySize {
+		ln.Close()
+		return ErrNTSProtocol
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer func() {
+		cancel()
+		ln.Close()
+		s.wg.Wait()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	config := s.config.TLS.Clone()
+	config.NextProtos = []string{ntsALPN}
+	config.MinVersion = tls.VersionTLS13
+
+	for {
+
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		s.wg.Add(1)
+
+		go func() {
+			defer s.wg.Done()
+			s.handle(tls.Server(conn, config))
+		}()
+
+	}
+
+}
+
+func (s *NTSKEServer) handle(conn *tls.Conn) {
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(ntsTimeout))
+
+	if err := conn.Handshake(); err != nil {
+		return
+	}
+
+	records, err := readRecords(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+
+	var protocol, aead bool
+
+	for _, r := range records {
+
+		switch r.typ {
+
+		case keNextProtocol:
+			protocol = contains(r.body, 0)
+
+		case keAEAD:
+			aead = contains(r.body, sivAlgorithm)
+
+		case keWarning, keServer, kePort, keCookie:
+
+		default:
+			if r.critical {
+				conn.Write(errorRecord(0))
+				return
+			}
+
+		}
+
+	}
+
+	if !protocol || !aead {
+		conn.Write(errorRecord(1))
+		return
+	}
+
+	c2s, s2c, err := ntsKeys(conn.ConnectionState())
+	if err != nil {
+		conn.Write(errorRecord(2))
+		return
+	}
+
+	var rsp []byte
+	rsp = appendRecord(rsp, true, keNextProtocol, uint16s(0))
+	rsp = appendRecord(rsp, false, keAEAD, uint16s(sivAlgorithm))
+
+	for i := 0; i < ntsCookies; i++ {
+
+		cookie, err := sealCookie(s.config.Key, c2s, s2c)
+		if err != nil {
+			conn.Write(errorRecord(2))
+			return
+		}
+
+		rsp = appendRecord(rsp, false, keCookie, cookie)
+	}
+
+	if len(s.config.Server) > 0 {
+		rsp = appendRecord(rsp, false, keServer, []byte(s.config.Server))
+	}
+
+	if s.config.Port != 0 {
+		rsp = appendRecord(rsp, false, kePort, uint16s(s.config.Port))
+	}
+
+	rsp = appendRecord(rsp, true, keEnd, nil)
+
+	conn.Write(rsp)
+}
+
+func errorRecord(code uint16) []byte {
+
+	var rsp []byte
+	rsp = appendRecord(rsp, true, keError, uint16s(code))
+	rsp = appendRecord(rsp, true, keEnd, nil)
+
+	return rsp
+}
+
+func contains(list []byte, v uint16) bool {
+
+	for i := 0; i+1 < len(list); i += 2 {
+		if binary.BigEndian.Uint16(list[i:]) == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sealCookie encrypts the session keys with the cookie key, only the
+// server can read the cookie.
+func sealCookie(key, c2s, s2c []byte) ([]byte, error) {
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed, err := sivSeal(key, append(append([]byte{}, c2s...), s2c...), nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(nonce, sealed...), nil
+}
+
+func openCookie(key, cookie []byte) ([]byte, []byte, error) {
+
+	if len(cookie) < 16 {
+		return nil, nil, errInvalidCookie
+	}
+
+	keys, err := sivOpen(key, cookie[16:], cookie[:16])
+	if err != nil || len(keys) != 2*sivKeySize {
+		return nil, nil, errInvalidCookie
+	}
+
+	return keys[:sivKeySize], keys[sivKeySize:], nil
+}
+
+// ntsAuthenticate checks the cookie and the authenticator of a request.
+// The reply echoes the unique id and carries new cookies encrypted with the
+// server to client key, a request which can't be authenticated is answered
+// by the kiss-o'-death NTSN.
+func (s *Server) ntsAuthenticate(msg []byte) (sealer, bool) {
+
+	fields, err := parseExtensions(msg)
+	if err != nil {
+		return nil, false
+	}
+
+	var uid, cookie []byte
+	var placeholders int
+	var auth *extension
+
+	for i, f := range fields {
+		switch f.typ {
+		case efUniqueID:
+			uid = f.body
+		case efCookie:
+			cookie = f.body
+		case efCookiePlaceholder:
+			placeholders++
+		case efAuthenticator:
+			auth = &fields[i]
+		}
+	}
+
+	if uid == nil {
+		return nil, false
+	}
+
+	nak := func(rsp []byte) []byte {
+		rsp[0] = uint8(LeapNotInSync)<<6 | rsp[0]&0x3f
+		rsp[1] = 0
+		binary.BigEndian.PutUint32(rsp[12:], RefID(KissNtsn))
+		return appendExtension(rsp, efUniqueID, uid)
+	}
+
+	if cookie == nil || auth == nil {
+		return nak, true
+	}
+
+	c2s, s2c, err := openCookie(s.config.NTSKey, cookie)
+	if err != nil {
+		return nak, true
+	}
+
+	nonce, sealed, err := parseAuthenticator(auth.body)
+	if err != nil {
+		return nak, true
+	}
+
+	if _, err := sivOpen(c2s, sealed, msg[:auth.offset], nonce); err != nil {
+		return nak, true
+	}
+
+	if placeholders > ntsCookies {
+		placeholders = ntsCookies
+	}
+
+	seal := func(rsp []byte) []byte {
+
+		rsp = appendExtension(rsp, efUniqueID, uid)
+
+		var cookies []byte
+		for i := 0; i <= placeholders; i++ {
+			if c, err := sealCookie(s.config.NTSKey, c2s, s2c); err == nil {
+				cookies = appendExtension(cookies, efCookie, c)
+			}
+		}
+
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nak(rsp[:headerSize])
+		}
+
+		sealed, err := sivSeal(s2c, cookies, rsp, nonce)
+		if err != nil {
+			return nak(rsp[:headerSize])
+		}
+
+		return appendExtension(rsp, efAuthenticator, authenticatorBody(nonce, sealed))
+	}
+
+	return seal, true
+}
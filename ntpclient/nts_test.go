@@ -0,0 +1,348 @@
+package ntp
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// selfSigned returns a certificate for localhost and a pool trusting it.
+func selfSigned(t *testing.T) (tls.Certificate, *x509.CertPool) {
+
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// proxy forwards datagrams between the client and the ntp server, the
+// tamper functions may modify them. forge modifies a copy of the reply
+// which is sent ahead of it.
+type proxy struct {
+	conn     net.PacketConn
+	server   net.Addr
+	request  func([]byte)
+	response func([]byte)
+	forge    func([]byte)
+	versions []uint8
+	mu       sync.Mutex
+}
+
+func (p *proxy) run() {
+
+	buf := make([]byte, 2048)
+
+	var client net.Addr
+
+	for {
+
+		n, addr, err := p.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		msg := buf[:n]
+
+		p.mu.Lock()
+
+		if addr.String() == p.server.String() {
+			if p.response != nil {
+				p.response(msg)
+			}
+			if p.forge != nil {
+				forged := append([]byte(nil), msg...)
+				p.forge(forged)
+				p.conn.WriteTo(forged, client)
+			}
+			p.mu.Unlock()
+			p.conn.WriteTo(msg, client)
+			continue
+		}
+
+		client = addr
+		p.versions = append(p.versions, (msg[0]>>3)&0x07)
+
+		if p.request != nil {
+			p.request(msg)
+		}
+
+		p.mu.Unlock()
+
+		p.conn.WriteTo(msg, p.server)
+	}
+}
+
+func (p *proxy) tamper(request, response func([]byte)) {
+	p.mu.Lock()
+	p.request, p.response = request, response
+	p.mu.Unlock()
+}
+
+// startNTS starts an ntp server with NTS, its key establishment server and
+// a proxy in front of the ntp server, the KE server announces the proxy.
+func startNTS(t *testing.T) (*NTS, *proxy) {
+
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	key, err := NewNTSKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := startServer(t, ServerConfig{NTSKey: key, RequireAuth: true}, Faults{})
+
+	serverAddr, err := net.ResolveUDPAddr("udp", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &proxy{conn: conn, server: serverAddr}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		p.run()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	cert, pool := selfSigned(t)
+
+	ke := NewNTSKEServer(NTSKEConfig{
+		Addr:   "127.0.0.1:0",
+		TLS:    &tls.Config{Certificates: []tls.Certificate{cert}},
+		Key:    key,
+		Server: "127.0.0.1",
+		Port:   uint16(conn.LocalAddr().(*net.UDPAddr).Port),
+	})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ke.ListenAndServe(ctx)
+	}()
+
+	for ke.Addr() == nil {
+		time.Sleep(time.Millisecond)
+	}
+
+	port := strconv.Itoa(ke.Addr().(*net.TCPAddr).Port)
+
+	nts, err := DialNTS(ctx, net.JoinHostPort("localhost", port), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nts, p
+}
+
+func (n *NTS) cookieCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.cookies)
+}
+
+func TestNTSKeyEstablishment(t *testing.T) {
+
+	nts, p := startNTS(t)
+
+	if want := p.conn.LocalAddr().String(); nts.Server() != want {
+		t.Errorf("negotiated server %s, want %s", nts.Server(), want)
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Errorf("got %d cookies, want %d", n, ntsCookies)
+	}
+
+	rsp, err := nts.Query(context.Background(), Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.ClockOffset < -10*time.Millisecond || rsp.ClockOffset > 10*time.Millisecond {
+		t.Errorf("offset %s, want about 0", rsp.ClockOffset)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, v := range p.versions {
+		if v != 4 {
+			t.Fatalf("request version %d, NTS requires 4", v)
+		}
+	}
+}
+
+func TestNTSUntrustedCertificate(t *testing.T) {
+
+	nts, _ := startNTS(t)
+
+	if _, err := DialNTS(context.Background(), nts.host, nil); err == nil {
+		t.Fatal("key establishment with an untrusted certificate succeeded")
+	}
+}
+
+func TestNTSCookieRefresh(t *testing.T) {
+
+	nts, _ := startNTS(t)
+
+	ctx := context.Background()
+
+	// every reply replaces the used cookie
+	for i := 0; i < 2*ntsCookies; i++ {
+		if _, err := nts.Query(ctx, Options{Timeout: time.Second}); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Fatalf("got %d cookies, want %d", n, ntsCookies)
+	}
+
+	// lost replies use up cookies, placeholders request the missing ones
+	nts.mu.Lock()
+	nts.cookies = nts.cookies[:1]
+	nts.mu.Unlock()
+
+	if _, err := nts.Query(ctx, Options{Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Fatalf("got %d cookies after placeholders, want %d", n, ntsCookies)
+	}
+
+	// no cookies left, the key establishment is run again
+	nts.mu.Lock()
+	nts.cookies = nil
+	nts.mu.Unlock()
+
+	if _, err := nts.Query(ctx, Options{Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Fatalf("got %d cookies after the key establishment, want %d", n, ntsCookies)
+	}
+}
+
+func TestNTSTamperedReply(t *testing.T) {
+
+	nts, p := startNTS(t)
+
+	// the last byte belongs to the sealed authenticator
+	p.tamper(nil, func(msg []byte) { msg[len(msg)-1] ^= 1 })
+
+	if _, err := nts.Query(context.Background(), Options{Timeout: time.Second}); err != ErrAuthFailed {
+		t.Fatalf("got %v, want %v", err, ErrAuthFailed)
+	}
+
+	// the offset fields are covered by the authenticator, too
+	p.tamper(nil, func(msg []byte) { msg[40] ^= 1 })
+
+	if _, err := nts.Query(context.Background(), Options{Timeout: time.Second}); err != ErrAuthFailed {
+		t.Fatalf("got %v, want %v", err, ErrAuthFailed)
+	}
+}
+
+func TestNTSForgedReply(t *testing.T) {
+
+	nts, p := startNTS(t)
+
+	// the forged reply echoes the origin and the unique id but fails the
+	// authentication, it is discarded
+	p.mu.Lock()
+	p.forge = func(msg []byte) { msg[len(msg)-1] ^= 1 }
+	p.mu.Unlock()
+
+	rsp, err := nts.Query(context.Background(), Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rsp.ClockOffset < -10*time.Millisecond || rsp.ClockOffset > 10*time.Millisecond {
+		t.Errorf("offset %s, want about 0", rsp.ClockOffset)
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Fatalf("got %d cookies, want %d", n, ntsCookies)
+	}
+}
+
+func TestNTSTamperedRequest(t *testing.T) {
+
+	nts, p := startNTS(t)
+
+	p.tamper(func(msg []byte) { msg[len(msg)-1] ^= 1 }, nil)
+
+	_, err := nts.Query(context.Background(), Options{Timeout: time.Second})
+	if kod, ok := err.(*KissOfDeathError); !ok || kod.Code != KissNtsn {
+		t.Fatalf("got %v, want kiss-o'-death %s", err, KissNtsn)
+	}
+
+	// the rejected session is keyed again
+	p.tamper(nil, nil)
+
+	if _, err := nts.Query(context.Background(), Options{Timeout: time.Second}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := nts.cookieCount(); n != ntsCookies {
+		t.Fatalf("got %d cookies, want %d", n, ntsCookies)
+	}
+}
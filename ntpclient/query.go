@@ -0,0 +1,241 @@
+package ntp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"time"
+)
+
+// LeapIndicator warns of a leap second inserted or deleted at the end of
+// the current day.
+type LeapIndicator uint8
+
+const (
+	LeapNone         LeapIndicator = 0
+	LeapInsertSecond LeapIndicator = 1
+	LeapDeleteSecond LeapIndicator = 2
+	LeapNotInSync    LeapIndicator = 3
+)
+
+// Response is the result of a query, the offset and the round trip delay
+// are computed from the four timestamps as described in RFC 5905.
+//
+//	t1 client transmit, t2 server receive, t3 server transmit, t4 client receive
+//
+//	offset = ((t2 - t1) + (t3 - t4)) / 2
+//	delay  = (t4 - t1) - (t3 - t2)
+type Response struct {
+	Time           time.Time     // server transmit time
+	ClockOffset    time.Duration // add to the local clock to get the server time
+	RTT            time.Duration // round trip delay without the server processing time
+	Precision      time.Duration // precision of the server clock
+	Stratum        uint8
+	ReferenceID    uint32
+	ReferenceTime  time.Time // time the server clock was last set or corrected
+	RootDelay      time.Duration
+	RootDispersion time.Duration
+	Leap           LeapIndicator
+}
+
+// Query sends a request to host and returns the server's timing
+// information, host defaults to pool.ntp.org:123 and timeout to 15s. A
+// server which doesn't reply in time returns a TimeoutError.
+func Query(host string, timeout time.Duration) (*Response, error) {
+
+	if timeout == 0 {
+		timeout = 15 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return QueryContext(ctx, host, Options{})
+}
+
+// authenticator protects a request, it returns the request and the check
+// of the reply. Implemented by symmetric keys and NTS.
+type authenticator interface {
+	authenticate(req []byte) ([]byte, func(rsp []byte) error, error)
+}
+
+// exchange sends a request on conn and reads the reply, the deadline of
+// conn has to be set by the caller. A nil auth disables authentication.
+func exchange(conn net.Conn, auth authenticator) (*Response, error) {
+
+	// 00 100 011 (or 0x23)
+	// |  |   +-- client mode (3)
+	// |  + ----- version (4), NTS requires NTPv4
+	// + -------- leap year indicator, 0 no warning
+	req := &packet{Settings: 0x23}
+
+	// the transmit time is random, the server echoes it as origin time and
+	// a spoofed reply can't guess it, t1 is kept locally
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	req.TxTimeSec = binary.BigEndian.Uint32(nonce[:4])
+	req.TxTimeFrac = binary.BigEndian.Uint32(nonce[4:])
+
+	var msg bytes.Buffer
+	if err := binary.Write(&msg, binary.BigEndian, req); err != nil {
+		return nil, err
+	}
+
+	data := msg.Bytes()
+
+	var verify func([]byte) error
+
+	if auth != nil {
+		var err error
+		if data, verify, err = auth.authenticate(data); err != nil {
+			return nil, err
+		}
+	}
+
+	t1 := time.Now()
+
+	if _, err := conn.Write(data); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 2048)
+
+	var n int
+	var t4 time.Time
+	rsp := &packet{}
+
+	// stray, late or spoofed packets are discarded, the read fails at the
+	// deadline of the connection if no reply arrives
+	var authErr error
+
+	for {
+
+		var err error
+
+		if n, err = conn.Read(buf); err != nil {
+			// only replies failing the authentication arrived
+			if ne, ok := err.(net.Error); ok && ne.Timeout() && authErr != nil {
+				return nil, authErr
+			}
+			return nil, err
+		}
+
+		t4 = time.Now()
+
+		if n < binary.Size(packet{}) {
+			continue
+		}
+
+		if err := binary.Read(bytes.NewReader(buf[:n]), binary.BigEndian, rsp); err != nil {
+			return nil, err
+		}
+
+		if rsp.OrigTimeSec != req.TxTimeSec || rsp.OrigTimeFrac != req.TxTimeFrac {
+			continue
+		}
+
+		// whoever sees the request can echo its origin, a forged reply
+		// must not abort the query
+		if verify != nil {
+			if err := verify(buf[:n]); err != nil {
+				authErr = err
+				continue
+			}
+		}
+
+		break
+	}
+
+	if err := validate(req, rsp); err != nil {
+		return nil, err
+	}
+
+	return parse(rsp, t1, t4), nil
+}
+
+// validate checks the reply against the request.
+func validate(req, rsp *packet) error {
+
+	if mode := rsp.Settings & 0x07; mode != 4 {
+		return ErrInvalidMode
+	}
+
+	if rsp.Stratum == 0 {
+		return &KissOfDeathError{Code: kissCode(rsp.ReferenceID)}
+	}
+
+	if rsp.Stratum > 15 {
+		return ErrInvalidStratum
+	}
+
+	if LeapIndicator(rsp.Settings>>6) == LeapNotInSync {
+		return ErrNotSynchronized
+	}
+
+	if rsp.TxTimeSec == 0 && rsp.TxTimeFrac == 0 {
+		return ErrInvalidTransmit
+	}
+
+	t2 := toTime(rsp.RxTimeSec, rsp.RxTimeFrac)
+	t3 := toTime(rsp.TxTimeSec, rsp.TxTimeFrac)
+
+	if t3.Before(t2) {
+		return ErrInvalidTimestamps
+	}
+
+	return nil
+}
+
+func parse(p *packet, t1, t4 time.Time) *Response {
+
+	t2 := toTime(p.RxTimeSec, p.RxTimeFrac)
+	t3 := toTime(p.TxTimeSec, p.TxTimeFrac)
+
+	// t4.Sub(t1) uses the monotonic clock, the server times are wall clock
+	rtt := t4.Sub(t1) - t3.Sub(t2)
+	if rtt < 0 {
+		rtt = 0
+	}
+
+	return &Response{
+		Time:           t3,
+		ClockOffset:    (t2.Sub(t1) + t3.Sub(t4.Round(0))) / 2,
+		RTT:            rtt,
+		Precision:      toInterval(p.Precision),
+		Stratum:        p.Stratum,
+		ReferenceID:    p.ReferenceID,
+		ReferenceTime:  toTime(p.RefTimeSec, p.RefTimeFrac),
+		RootDelay:      toDuration(p.RootDelay),
+		RootDispersion: toDuration(p.RootDispersion),
+		Leap:           LeapIndicator(p.Settings >> 6),
+	}
+}
+
+// toTime converts the seconds and fraction fields of a packet.
+func toTime(sec, frac uint32) time.Time {
+	return NewTimestampParts(sec, frac).Time()
+}
+
+func toNtpTime(t time.Time) (uint32, uint32) {
+	ts := NewTimestamp(t)
+	return ts.Seconds(), ts.Fraction()
+}
+
+func toDuration(v uint32) time.Duration {
+	return Short(v).Duration()
+}
+
+// toInterval converts a log2 seconds exponent to a duration.
+func toInterval(exp int8) time.Duration {
+
+	if exp >= 0 {
+		return time.Second << uint(exp)
+	}
+
+	return time.Second >> uint(-exp)
+}
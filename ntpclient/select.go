@@ -0,0 +1,193 @@
+package ntp
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoResponse = errors.New("ntp: no server responded")
+	ErrNoMajority = errors.New("ntp: no majority of servers agrees")
+)
+
+// Estimate combines the replies of several servers.
+type Estimate struct {
+	ClockOffset  time.Duration // offsets of the survivors weighted by root distance
+	Error        time.Duration // the true offset is within ClockOffset ± Error
+	Survivors    []string      // servers agreeing with the intersection
+	Falsetickers []string      // servers discarded by the intersection
+	Responses    map[string]*Response
+	Errors       map[string]error
+}
+
+// QueryServers queries the hosts concurrently, each with its own timeout,
+// and selects the servers which agree on the offset.
+//
+// Every reply gives the interval offset ± root distance, which contains the
+// true offset if the server is correct. The intersection contained in most
+// intervals is selected (Marzullo's algorithm), the servers not overlapping
+// it are falsetickers. The intersection has to be confirmed by a majority of
+// the responding servers. The offsets of the survivors are combined, each
+// weighted by the inverse of its root distance.
+func QueryServers(hosts []string, timeout time.Duration) (*Estimate, error) {
+
+	type result struct {
+		host string
+		rsp  *Response
+		err  error
+	}
+
+	results := make([]result, len(hosts))
+
+	var wg sync.WaitGroup
+
+	for i, host := range hosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			rsp, err := Query(host, timeout)
+			results[i] = result{host: host, rsp: rsp, err: err}
+		}(i, host)
+	}
+
+	wg.Wait()
+
+	est := &Estimate{
+		Responses: make(map[string]*Response),
+		Errors:    make(map[string]error),
+	}
+
+	var firstErr error
+
+	for _, r := range results {
+		if r.err != nil {
+			est.Errors[r.host] = r.err
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			continue
+		}
+		est.Responses[r.host] = r.rsp
+	}
+
+	if len(est.Responses) == 0 {
+		if firstErr != nil {
+			return est, firstErr
+		}
+		return est, ErrNoResponse
+	}
+
+	lo, hi, count := intersect(est.Responses)
+
+	if count <= len(est.Responses)/2 {
+		return est, ErrNoMajority
+	}
+
+	var survivors []*Response
+
+	for _, host := range hosts {
+		rsp, ok := est.Responses[host]
+		if !ok {
+			continue
+		}
+		l, h := bounds(rsp)
+		if h < lo || l > hi {
+			est.Falsetickers = append(est.Falsetickers, host)
+		} else {
+			est.Survivors = append(est.Survivors, host)
+			survivors = append(survivors, rsp)
+		}
+	}
+
+	est.ClockOffset = combine(survivors)
+
+	// the true offset is within the intersection
+	est.Error = hi - est.ClockOffset
+	if e := est.ClockOffset - lo; e > est.Error {
+		est.Error = e
+	}
+
+	return est, nil
+}
+
+// combine returns the mean of the offsets weighted by the inverse of the
+// root distance, precise replies count more.
+func combine(responses []*Response) time.Duration {
+
+	var sum, weights float64
+
+	for _, rsp := range responses {
+
+		d := rsp.RootDistance()
+		if d < time.Nanosecond {
+			d = time.Nanosecond
+		}
+
+		w := 1 / float64(d)
+		sum += w * float64(rsp.ClockOffset)
+		weights += w
+	}
+
+	if weights == 0 {
+		return 0
+	}
+
+	return time.Duration(sum / weights)
+}
+
+// RootDistance is the maximum error of the offset of a reply.
+func (r *Response) RootDistance() time.Duration {
+	return r.RTT/2 + r.RootDelay/2 + r.RootDispersion + r.Precision
+}
+
+func bounds(r *Response) (time.Duration, time.Duration) {
+	d := r.RootDistance()
+	return r.ClockOffset - d, r.ClockOffset + d
+}
+
+// intersect returns the interval contained in most of the reply intervals.
+func intersect(responses map[string]*Response) (time.Duration, time.Duration, int) {
+
+	type edge struct {
+		offset time.Duration
+		start  bool
+	}
+
+	edges := make([]edge, 0, 2*len(responses))
+
+	for _, rsp := range responses {
+		l, h := bounds(rsp)
+		edges = append(edges, edge{l, true}, edge{h, false})
+	}
+
+	// on ties the starts come first, touching intervals intersect
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].offset == edges[j].offset {
+			return edges[i].start && !edges[j].start
+		}
+		return edges[i].offset < edges[j].offset
+	})
+
+	var lo, hi time.Duration
+	var count, best int
+
+	for i, e := range edges {
+
+		if !e.start {
+			count--
+			continue
+		}
+
+		count++
+
+		if count > best {
+			best = count
+			lo = e.offset
+			hi = edges[i+1].offset
+		}
+	}
+
+	return lo, hi, best
+}
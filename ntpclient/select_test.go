@@ -0,0 +1,195 @@
+package ntp
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+	"time"
+)
+
+// startServer starts a local server with the faults, it is stopped when
+// the test has finished.
+func startServer(t *testing.T, config ServerConfig, faults Faults) string {
+
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewServer(config)
+	s.SetFaults(faults)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		s.Serve(ctx, conn)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func TestQueryServersFalseticker(t *testing.T) {
+
+	good := []string{
+		startServer(t, ServerConfig{}, Faults{}),
+		startServer(t, ServerConfig{}, Faults{}),
+		startServer(t, ServerConfig{}, Faults{}),
+	}
+	bad := startServer(t, ServerConfig{}, Faults{Skew: time.Second})
+
+	est, err := QueryServers(append(good, bad), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(est.Falsetickers) != 1 || est.Falsetickers[0] != bad {
+		t.Errorf("falsetickers %v, want [%s]", est.Falsetickers, bad)
+	}
+
+	sort.Strings(good)
+	sort.Strings(est.Survivors)
+
+	if len(est.Survivors) != len(good) {
+		t.Fatalf("survivors %v, want %v", est.Survivors, good)
+	}
+
+	for i := range good {
+		if est.Survivors[i] != good[i] {
+			t.Fatalf("survivors %v, want %v", est.Survivors, good)
+		}
+	}
+
+	if est.ClockOffset < -10*time.Millisecond || est.ClockOffset > 10*time.Millisecond {
+		t.Errorf("offset %s, want about 0", est.ClockOffset)
+	}
+
+	if est.Error < 0 || est.Error > 10*time.Millisecond {
+		t.Errorf("error %s, want a few microseconds", est.Error)
+	}
+}
+
+func TestQueryServersNoMajority(t *testing.T) {
+
+	hosts := []string{
+		startServer(t, ServerConfig{}, Faults{Skew: time.Second}),
+		startServer(t, ServerConfig{}, Faults{Skew: time.Second}),
+		startServer(t, ServerConfig{}, Faults{Skew: -time.Second}),
+		startServer(t, ServerConfig{}, Faults{Skew: -time.Second}),
+	}
+
+	est, err := QueryServers(hosts, time.Second)
+	if err != ErrNoMajority {
+		t.Fatalf("got %v, want %v", err, ErrNoMajority)
+	}
+
+	if len(est.Responses) != len(hosts) {
+		t.Errorf("got %d responses, want %d", len(est.Responses), len(hosts))
+	}
+}
+
+func TestQueryServersErrors(t *testing.T) {
+
+	good := startServer(t, ServerConfig{}, Faults{})
+	kiss := startServer(t, ServerConfig{}, Faults{Kiss: KissDeny})
+
+	est, err := QueryServers([]string{good, kiss}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(est.Survivors) != 1 || est.Survivors[0] != good {
+		t.Errorf("survivors %v, want [%s]", est.Survivors, good)
+	}
+
+	kod, ok := est.Errors[kiss].(*KissOfDeathError)
+	if !ok || !kod.Denied() {
+		t.Errorf("error of %s is %v, want a kiss-o'-death", kiss, est.Errors[kiss])
+	}
+}
+
+// response returns a reply with the offset and root distance.
+func response(offset, distance time.Duration) *Response {
+	return &Response{ClockOffset: offset, RootDispersion: distance}
+}
+
+func TestIntersect(t *testing.T) {
+
+	ms := time.Millisecond
+
+	tests := []struct {
+		name      string
+		responses []*Response
+		lo, hi    time.Duration
+		count     int
+	}{
+		{
+			name:      "nested",
+			responses: []*Response{response(0, 10*ms), response(2*ms, 2*ms), response(ms, 2*ms)},
+			lo:        0,
+			hi:        3 * ms,
+			count:     3,
+		},
+		{
+			name:      "touching intervals intersect",
+			responses: []*Response{response(-ms, ms), response(ms, ms)},
+			lo:        0,
+			hi:        0,
+			count:     2,
+		},
+		{
+			name:      "tie keeps the lowest intersection",
+			responses: []*Response{response(-5*ms, ms), response(-5*ms, ms), response(5*ms, ms), response(5*ms, ms)},
+			lo:        -6 * ms,
+			hi:        -4 * ms,
+			count:     2,
+		},
+		{
+			name:      "disjoint",
+			responses: []*Response{response(-5*ms, ms), response(0, ms), response(5*ms, ms)},
+			lo:        -6 * ms,
+			hi:        -4 * ms,
+			count:     1,
+		},
+	}
+
+	for _, test := range tests {
+
+		responses := make(map[string]*Response)
+		for i, rsp := range test.responses {
+			responses[string(rune('a'+i))] = rsp
+		}
+
+		lo, hi, count := intersect(responses)
+
+		if lo != test.lo || hi != test.hi || count != test.count {
+			t.Errorf("%s: got [%s, %s] of %d, want [%s, %s] of %d",
+				test.name, lo, hi, count, test.lo, test.hi, test.count)
+		}
+	}
+}
+
+func TestCombine(t *testing.T) {
+
+	ms := time.Millisecond
+
+	// the first reply is twice as precise and counts twice
+	got := combine([]*Response{response(0, ms), response(3*ms, 2*ms)})
+
+	if got != ms {
+		t.Errorf("got %s, want %s", got, ms)
+	}
+
+	if got := combine(nil); got != 0 {
+		t.Errorf("got %s without replies, want 0", got)
+	}
+}
@@ -0,0 +1,284 @@
+package ntp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+)
+
+// ServerConfig configures an SNTP server.
+type ServerConfig struct {
+	Addr        string        // defaults to :123
+	Clock       clock.Clock   // defaults to the system clock
+	Stratum     uint8         // defaults to 1
+	ReferenceID uint32        // defaults to LOCL, see RefID
+	Leap        LeapIndicator // announced leap second
+	Precision   int8          // log2 seconds, defaults to -20
+	Keys        Keys          // keys of authenticated clients
+	NTSKey      []byte        // cookie key shared with the NTS-KE server
+	RequireAuth bool          // ignore unauthenticated requests
+}
+
+// Faults make the server misbehave, for testing clients.
+type Faults struct {
+	Delay time.Duration // delays every reply
+	Drop  float64       // probability a request is ignored, 0 to 1
+	Skew  time.Duration // added to the server time
+	Kiss  string        // replies with this kiss-o'-death code, e.g. RATE
+}
+
+// Server answers SNTP client requests, RFC 4330.
+type Server struct {
+	config ServerConfig
+	faults Faults
+	conn   net.PacketConn
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+}
+
+// RefID converts an ascii reference id like GPS or LOCL.
+func RefID(code string) uint32 {
+
+	var id [4]byte
+	copy(id[:], code)
+
+	return binary.BigEndian.Uint32(id[:])
+}
+
+func NewServer(config ServerConfig) *Server {
+
+	if len(config.Addr) == 0 {
+		config.Addr = ":123"
+	}
+
+	if config.Clock == nil {
+		config.Clock = clock.System
+	}
+
+	if config.Stratum == 0 {
+		config.Stratum = 1
+	}
+
+	if config.ReferenceID == 0 {
+		config.ReferenceID = RefID("LOCL")
+	}
+
+	if config.Precision == 0 {
+		config.Precision = -20
+	}
+
+	return &Server{config: config}
+}
+
+// SetFaults changes the fault injection of a running server.
+func (s *Server) SetFaults(faults Faults) {
+	s.mu.Lock()
+	s.faults = faults
+	s.mu.Unlock()
+}
+
+// Addr returns the address the server listens on, nil before it listens.
+func (s *Server) Addr() net.Addr {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.conn == nil {
+		return nil
+	}
+
+	return s.conn.LocalAddr()
+}
+
+// ListenAndServe listens on the configured address and serves requests
+// until ctx is done.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+
+	conn, err := net.ListenPacket("udp", s.config.Addr)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(ctx, conn)
+}
+
+// Serve serves requests received on conn until ctx is done, conn is closed
+// on return. Delayed replies are aborted, Serve returns after the pending
+// replies have finished.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	defer func() {
+		cancel()
+		conn.Close()
+		s.wg.Wait()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	buf := make([]byte, 2048)
+
+	for {
+
+		n, addr, err := conn.ReadFrom(buf)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+
+		rx := s.config.Clock.Now()
+
+		req := &packet{}
+		if n < binary.Size(req) {
+			continue
+		}
+
+		if err := binary.Read(bytes.NewReader(buf[:n]), binary.BigEndian, req); err != nil {
+			continue
+		}
+
+		// answer client requests only
+		if req.Settings&0x07 != 3 {
+			continue
+		}
+
+		s.mu.RLock()
+		faults := s.faults
+		s.mu.RUnlock()
+
+		if faults.Drop > 0 && rand.Float64() < faults.Drop {
+			continue
+		}
+
+		// the sealer may keep parts of the request beyond the next read
+		seal, ok := s.authenticate(append([]byte{}, buf[:n]...))
+		if !ok {
+			continue
+		}
+
+		data := s.reply(req, rx, faults, seal)
+		if data == nil {
+			continue
+		}
+
+		if faults.Delay <= 0 {
+			conn.WriteTo(data, addr)
+			continue
+		}
+
+		// the reply is stamped before the delay, like a reply delayed on
+		// the network, the client sees a larger round trip delay
+		s.wg.Add(1)
+
+		go func(data []byte, addr net.Addr, delay <-chan time.Time) {
+
+			defer s.wg.Done()
+
+			select {
+			case <-delay:
+				conn.WriteTo(data, addr)
+			case <-ctx.Done():
+			}
+
+		}(data, addr, s.config.Clock.After(faults.Delay))
+
+	}
+
+}
+
+// sealer appends the authentication of a reply.
+type sealer func(rsp []byte) []byte
+
+// cryptoNAK answers requests signed with an unknown key or an invalid MAC.
+func cryptoNAK(rsp []byte) []byte {
+	return append(rsp, 0, 0, 0, 0)
+}
+
+// authenticate returns the sealer of the reply and if the request should
+// be answered, the sealer of an unauthenticated request is nil.
+func (s *Server) authenticate(msg []byte) (sealer, bool) {
+
+	if len(msg) > headerSize+4+sha1.Size {
+		if s.config.NTSKey == nil {
+			return nil, !s.config.RequireAuth
+		}
+		return s.ntsAuthenticate(msg)
+	}
+
+	id, signed := macKeyID(msg)
+
+	if !signed {
+		return nil, !s.config.RequireAuth
+	}
+
+	key, exist := s.config.Keys[id]
+
+	if !exist || key.verify(msg) != nil {
+		return cryptoNAK, true
+	}
+
+	return key.sign, true
+}
+
+// reply returns the stamped and sealed reply, nil on failure.
+func (s *Server) reply(req *packet, rx time.Time, faults Faults, seal sealer) []byte {
+
+	cfg := s.config
+
+	version := (req.Settings >> 3) & 0x07
+
+	rsp := &packet{
+		Settings:    uint8(cfg.Leap)<<6 | version<<3 | 4,
+		Stratum:     cfg.Stratum,
+		Poll:        req.Poll,
+		Precision:   cfg.Precision,
+		ReferenceID: cfg.ReferenceID,
+	}
+
+	if len(faults.Kiss) > 0 {
+		rsp.Settings = uint8(LeapNotInSync)<<6 | version<<3 | 4
+		rsp.Stratum = 0
+		rsp.ReferenceID = RefID(faults.Kiss)
+	}
+
+	rsp.OrigTimeSec, rsp.OrigTimeFrac = req.TxTimeSec, req.TxTimeFrac
+	rsp.RxTimeSec, rsp.RxTimeFrac = toNtpTime(rx.Add(faults.Skew))
+	rsp.RefTimeSec, rsp.RefTimeFrac = rsp.RxTimeSec, 0
+
+	tx := cfg.Clock.Now().Add(faults.Skew)
+	rsp.TxTimeSec, rsp.TxTimeFrac = toNtpTime(tx)
+
+	var out bytes.Buffer
+	if err := binary.Write(&out, binary.BigEndian, rsp); err != nil {
+		return nil
+	}
+
+	data := out.Bytes()
+
+	if seal != nil {
+		data = seal(data)
+	}
+
+	return data
+}
@@ -0,0 +1,110 @@
+package ntp
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// AEAD_AES_SIV_CMAC_256, RFC 5297, the mandatory algorithm of NTS. The
+// first half of the key authenticates, the second half encrypts.
+const (
+	sivAlgorithm = 15
+	sivKeySize   = 32
+)
+
+// sivSeal encrypts plaintext, the associated data components are
+// authenticated in order, the nonce is the last of them.
+func sivSeal(key, plaintext []byte, ad ...[]byte) ([]byte, error) {
+
+	mac, ctr, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := s2v(mac, plaintext, ad)
+
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	copy(out, v)
+
+	sivCTR(ctr, v, out[aes.BlockSize:], plaintext)
+
+	return out, nil
+}
+
+// sivOpen decrypts and authenticates ciphertext sealed by sivSeal.
+func sivOpen(key, ciphertext []byte, ad ...[]byte) ([]byte, error) {
+
+	if len(ciphertext) < aes.BlockSize {
+		return nil, ErrAuthFailed
+	}
+
+	mac, ctr, err := sivCiphers(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v := ciphertext[:aes.BlockSize]
+
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	sivCTR(ctr, v, plaintext, ciphertext[aes.BlockSize:])
+
+	if subtle.ConstantTimeCompare(v, s2v(mac, plaintext, ad)) != 1 {
+		return nil, ErrAuthFailed
+	}
+
+	return plaintext, nil
+}
+
+func sivCiphers(key []byte) (cipher.Block, cipher.Block, error) {
+
+	if len(key) != sivKeySize {
+		return nil, nil, aes.KeySizeError(len(key))
+	}
+
+	mac, err := aes.NewCipher(key[:sivKeySize/2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctr, err := aes.NewCipher(key[sivKeySize/2:])
+
+	return mac, ctr, err
+}
+
+// s2v is the pseudo random function of SIV, the plaintext is the last
+// component.
+func s2v(mac cipher.Block, plaintext []byte, ad [][]byte) []byte {
+
+	d := cmacBlock(mac, make([]byte, aes.BlockSize))
+
+	for _, s := range ad {
+		d = shift(d)
+		xor(d, d, cmacBlock(mac, s))
+	}
+
+	var t []byte
+
+	if len(plaintext) >= aes.BlockSize {
+		t = append([]byte{}, plaintext...)
+		end := t[len(t)-aes.BlockSize:]
+		xor(end, end, d)
+	} else {
+		t = make([]byte, aes.BlockSize)
+		copy(t, plaintext)
+		t[len(plaintext)] = 0x80
+		xor(t, t, shift(d))
+	}
+
+	return cmacBlock(mac, t)
+}
+
+// sivCTR en- or decrypts src, the counter is v with bit 31 and 63 cleared.
+func sivCTR(ctr cipher.Block, v, dst, src []byte) {
+
+	q := append([]byte{}, v...)
+	q[8] &= 0x7f
+	q[12] &= 0x7f
+
+	cipher.NewCTR(ctr, q).XORKeyStream(dst, src)
+}
@@ -5,8 +5,6 @@ package ntp
 // Copyright (c) 2017 Vladimir Vivien
 
 import (
-	"encoding/binary"
-	"net"
 	"time"
 )
 
@@ -60,53 +58,14 @@ type packet struct {
 	TxTimeFrac     uint32 // transmit time frac
 }
 
+// Time returns the current time of the server at host corrected by the
+// network delay, see Query.
 func Time(host string, timeout time.Duration) (time.Time, error) {
 
-	if len(host) == 0 {
-		host = "pool.ntp.org:123"
-	}
-	if timeout == 0 {
-		timeout = 15 * time.Second
-	}
-
-	// Setup a UDP connection
-	conn, err := net.Dial("udp", host)
+	rsp, err := Query(host, timeout)
 	if err != nil {
 		return time.Unix(0, 0), err
 	}
 
-	defer conn.Close()
-
-	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
-		return time.Unix(0, 0), err
-	}
-
-	// configure request settings by specifying the first byte as
-	// 00 011 011 (or 0x1B)
-	// |  |   +-- client mode (3)
-	// |  + ----- version (3)
-	// + -------- leap year indicator, 0 no warning
-	req := &packet{Settings: 0x1B}
-
-	// send time request
-	if err := binary.Write(conn, binary.BigEndian, req); err != nil {
-		return time.Unix(0, 0), err
-	}
-
-	// block to receive server response
-	rsp := &packet{}
-	if err := binary.Read(conn, binary.BigEndian, rsp); err != nil {
-		return time.Unix(0, 0), err
-	}
-
-	// On POSIX-compliant OS, time is expressed
-	// using the Unix time epoch (or secs since year 1970).
-	// NTP seconds are counted since 1900 and therefore must
-	// be corrected with an epoch offset to convert NTP seconds
-	// to Unix time by removing 70 yrs of seconds (1970-1900)
-	// or 2208988800 seconds.
-	secs := float64(rsp.TxTimeSec) - ntpEpochOffset
-	nanos := (int64(rsp.TxTimeFrac) * 1e9) >> 32 // convert fractional to nanos
-
-	return time.Unix(int64(secs), nanos), nil
+	return time.Now().Add(rsp.ClockOffset), nil
 }
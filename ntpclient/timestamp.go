@@ -0,0 +1,133 @@
+package ntp
+
+import (
+	"time"
+)
+
+// eraSeconds is the length of an ntp era, the seconds of a timestamp wrap
+// around every 2^32 seconds, the first time on 2036-02-07.
+const eraSeconds = 1 << 32
+
+// DefaultPivot is the start of the 136 years window Time resolves
+// timestamps to, 1968-01-20T03:14:08Z in unix seconds. It maps timestamps
+// with the high bit set to era 0 (1968-2036) and the others to era 1
+// (2036-2104), RFC 4330 section 3. TimeAfter takes another pivot.
+const DefaultPivot = -61505152
+
+// Timestamp is the 64 bit ntp timestamp format, 32 bit seconds since 1900
+// and a 32 bit fraction of a second.
+type Timestamp uint64
+
+// Short is the 32 bit ntp short format, 16 bit seconds and a 16 bit
+// fraction, used for root delay and root dispersion.
+type Short uint32
+
+// NewTimestamp converts t, the era is lost, the fraction is rounded to the
+// nearest 2^-32 seconds.
+func NewTimestamp(t time.Time) Timestamp {
+
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond())<<32 + 5e8) / 1e9
+
+	return Timestamp(secs<<32 | frac)
+}
+
+// NewTimestampParts returns the timestamp of the seconds and fraction
+// fields of a packet.
+func NewTimestampParts(sec, frac uint32) Timestamp {
+	return Timestamp(uint64(sec)<<32 | uint64(frac))
+}
+
+func (ts Timestamp) Seconds() uint32 {
+	return uint32(ts >> 32)
+}
+
+func (ts Timestamp) Fraction() uint32 {
+	return uint32(ts)
+}
+
+// IsZero reports if the timestamp is unset.
+func (ts Timestamp) IsZero() bool {
+	return ts == 0
+}
+
+// Time resolves the timestamp in the window starting at DefaultPivot.
+func (ts Timestamp) Time() time.Time {
+	return ts.TimeAfter(time.Unix(DefaultPivot, 0))
+}
+
+// TimeAfter resolves the timestamp in the window of one era starting at
+// pivot. The fraction is rounded to the nearest nanosecond, the conversion
+// is lossless for timestamps created by NewTimestamp of a time within the
+// window.
+func (ts Timestamp) TimeAfter(pivot time.Time) time.Time {
+
+	base := pivot.Unix() + ntpEpochOffset
+
+	// seconds since the pivot modulo the era length
+	delta := (int64(ts.Seconds()) - base) % eraSeconds
+	if delta < 0 {
+		delta += eraSeconds
+	}
+
+	secs := base + delta - ntpEpochOffset
+	nanos := (uint64(ts.Fraction())*1e9 + 1<<31) >> 32
+
+	if nanos == 1e9 {
+		secs++
+		nanos = 0
+	}
+
+	return time.Unix(secs, int64(nanos))
+}
+
+// Era returns the ntp era of the timestamp resolved by Time, 0 up to 2036.
+func (ts Timestamp) Era() int64 {
+
+	secs := ts.Time().Unix() + ntpEpochOffset
+
+	if secs < 0 {
+		return (secs+1)/eraSeconds - 1
+	}
+
+	return secs / eraSeconds
+}
+
+// Sub returns ts-u with the fraction, the difference is exact for
+// timestamps less than 68 years apart.
+func (ts Timestamp) Sub(u Timestamp) time.Duration {
+
+	// two's complement difference of the 32.32 fixed point values
+	d := int64(ts - u)
+
+	secs := d >> 32
+	frac := d & (1<<32 - 1)
+
+	return time.Duration(secs)*time.Second + time.Duration((frac*1e9+1<<31)>>32)
+}
+
+// NewShort converts d, negative durations are 0 and durations of 2^16
+// seconds and more are clamped.
+func NewShort(d time.Duration) Short {
+
+	if d <= 0 {
+		return 0
+	}
+
+	// the shift overflows above about 78 hours
+	if d >= 1<<16*time.Second {
+		return 1<<32 - 1
+	}
+
+	v := (uint64(d)<<16 + 5e8) / 1e9
+	if v > 1<<32-1 {
+		v = 1<<32 - 1
+	}
+
+	return Short(v)
+}
+
+// Duration rounds the short format to the nearest nanosecond.
+func (s Short) Duration() time.Duration {
+	return time.Duration((uint64(s)*1e9 + 1<<15) >> 16)
+}
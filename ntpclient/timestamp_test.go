@@ -0,0 +1,177 @@
+package ntp
+
+import (
+	"math"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+// eraStart is the first time the seconds wrap around.
+var eraStart = time.Date(2036, 2, 7, 6, 28, 16, 0, time.UTC)
+
+func TestTimestampRoundTrip(t *testing.T) {
+
+	// times within the window of the pivot are converted losslessly
+	f := func(secs uint32, nanos uint32) bool {
+		tm := time.Unix(DefaultPivot+int64(secs), int64(nanos%1e9))
+		return NewTimestamp(tm).Time().Equal(tm)
+	}
+
+	if err := quick.Check(f, &quick.Config{MaxCount: 100000}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a nanosecond is about 4.3 fractions, the round trip is off by at most
+	// half a nanosecond
+	g := func(v uint64) bool {
+		d := int64(NewTimestamp(Timestamp(v).Time()) - Timestamp(v))
+		return d >= -3 && d <= 3
+	}
+
+	if err := quick.Check(g, &quick.Config{MaxCount: 100000}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimestampFractionRounding(t *testing.T) {
+
+	tests := []struct {
+		nanos int
+		frac  uint32
+	}{
+		{0, 0},
+		{1, 4},                          // 4.29 rounds down
+		{500000000, 1 << 31},            // exactly half a second
+		{999999999, math.MaxUint32 - 3}, // 2^32 - 4.29 rounds up
+	}
+
+	for _, test := range tests {
+
+		ts := NewTimestamp(time.Unix(0, int64(test.nanos)))
+
+		if ts.Fraction() != test.frac {
+			t.Errorf("fraction of %dns is %d, want %d", test.nanos, ts.Fraction(), test.frac)
+		}
+	}
+
+	// the largest fraction rounds up to the next second
+	ts := NewTimestampParts(100, math.MaxUint32)
+
+	if got, want := ts.Time(), NewTimestampParts(101, 0).Time(); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestTimestampEraBoundary(t *testing.T) {
+
+	if ts := NewTimestamp(eraStart); ts.Seconds() != 0 || ts.Fraction() != 0 {
+		t.Fatalf("timestamp of %s is %d.%d, want 0.0", eraStart, ts.Seconds(), ts.Fraction())
+	}
+
+	for _, d := range []time.Duration{-time.Second, -1, 0, 1, time.Second / 2, time.Second} {
+
+		tm := eraStart.Add(d)
+		ts := NewTimestamp(tm)
+
+		if got := ts.Time(); !got.Equal(tm) {
+			t.Errorf("%s resolved to %s", tm, got)
+		}
+
+		var want int64
+		if d >= 0 {
+			want = 1
+		}
+
+		if ts.Era() != want {
+			t.Errorf("era of %s is %d, want %d", tm, ts.Era(), want)
+		}
+	}
+
+	// the window ends one era after the pivot
+	pivot := time.Unix(DefaultPivot, 0).UTC()
+	end := pivot.Add(eraSeconds * time.Second)
+
+	if got := NewTimestamp(end).Time(); !got.Equal(pivot) {
+		t.Errorf("end of the window resolved to %s, want %s", got, pivot)
+	}
+}
+
+func TestTimestampTimeAfter(t *testing.T) {
+
+	pivot := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tm := range []time.Time{
+		pivot,
+		time.Date(2036, 2, 7, 6, 28, 15, 999999999, time.UTC),
+		time.Date(2100, 1, 1, 0, 0, 0, 1, time.UTC),
+	} {
+		if got := NewTimestamp(tm).TimeAfter(pivot); !got.Equal(tm) {
+			t.Errorf("%s resolved to %s after %s", tm, got, pivot)
+		}
+	}
+
+	// just before the pivot is the end of the window
+	if got := NewTimestamp(pivot.Add(-time.Second)).TimeAfter(pivot); got.Year() != 2166 {
+		t.Errorf("resolved to %s, want the end of the window in 2166", got)
+	}
+}
+
+func TestTimestampSub(t *testing.T) {
+
+	a := NewTimestamp(eraStart.Add(-time.Second / 3))
+	b := NewTimestamp(eraStart.Add(time.Second / 4))
+
+	// across the era boundary
+	if d := b.Sub(a); d != time.Second/3+time.Second/4 {
+		t.Errorf("got %s, want %s", d, time.Second/3+time.Second/4)
+	}
+
+	if d := a.Sub(b); d != -(time.Second/3 + time.Second/4) {
+		t.Errorf("got %s, want %s", d, -(time.Second/3 + time.Second/4))
+	}
+
+	f := func(secs uint32, nanos uint32, delta int32) bool {
+		tm := time.Unix(DefaultPivot+int64(secs), int64(nanos%1e9))
+		d := time.Duration(delta) * time.Millisecond
+		got := NewTimestamp(tm.Add(d)).Sub(NewTimestamp(tm)) - d
+		return got >= -time.Nanosecond && got <= time.Nanosecond
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShort(t *testing.T) {
+
+	tests := []struct {
+		d    time.Duration
+		want Short
+	}{
+		{-time.Second, 0},
+		{0, 0},
+		{time.Second, 1 << 16},
+		{time.Second / 2, 1 << 15},
+		{1<<16*time.Second - time.Nanosecond, math.MaxUint32},
+		{1 << 16 * time.Second, math.MaxUint32},
+		{100 * time.Hour, math.MaxUint32},
+		{math.MaxInt64, math.MaxUint32},
+	}
+
+	for _, test := range tests {
+		if got := NewShort(test.d); got != test.want {
+			t.Errorf("NewShort(%s) = %#x, want %#x", test.d, uint32(got), uint32(test.want))
+		}
+	}
+
+	// a fraction is about 15.3µs, the round trip is exact
+	f := func(v uint32) bool {
+		s := Short(v)
+		return NewShort(s.Duration()) == s
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Compression selects the decompression of a LineReader.
+type Compression int
+
+const (
+	CompressionAuto Compression = iota // detect by magic bytes
+	CompressionNone
+	CompressionGzip
+	CompressionZstd
+	CompressionBzip2
+	CompressionXz
+)
+
+var magic = []struct {
+	compression Compression
+	prefix      []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionXz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+}
+
+// bzip2 streams start with "BZh", the block size '1'..'9' and the magic of
+// the first block, or of the stream end if the stream is empty.
+var (
+	bzip2Block = []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}
+	bzip2End   = []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90}
+)
+
+func isBzip2(head []byte) bool {
+
+	if len(head) < 10 || !bytes.HasPrefix(head, []byte("BZh")) || head[3] < '1' || head[3] > '9' {
+		return false
+	}
+
+	return bytes.Equal(head[4:10], bzip2Block) || bytes.Equal(head[4:10], bzip2End)
+}
+
+// Detect returns the compression of the stream by its magic bytes,
+// CompressionNone if it isn't compressed. The returned reader replaces r.
+func Detect(r io.Reader) (Compression, io.Reader, error) {
+
+	br := bufio.NewReader(r)
+
+	head, err := br.Peek(10)
+	if err != nil && err != io.EOF {
+		return CompressionNone, br, err
+	}
+
+	for _, m := range magic {
+		if bytes.HasPrefix(head, m.prefix) {
+			return m.compression, br, nil
+		}
+	}
+
+	if isBzip2(head) {
+		return CompressionBzip2, br, nil
+	}
+
+	return CompressionNone, br, nil
+}
+
+// Decompress returns a reader of the decompressed stream, the reader has to
+// be closed.
+func Decompress(r io.Reader, compression Compression) (io.ReadCloser, error) {
+
+	if compression == CompressionAuto {
+		var err error
+		if compression, r, err = Detect(r); err != nil {
+			return nil, err
+		}
+	}
+
+	switch compression {
+
+	case CompressionGzip:
+		return gzip.NewReader(r)
+
+	case CompressionZstd:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+
+	case CompressionBzip2:
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+
+	case CompressionXz:
+		dec, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(dec), nil
+
+	}
+
+	return ioutil.NopCloser(r), nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		input string
+		want  Compression
+	}{
+		{"empty", "", CompressionNone},
+		{"text", "first\nsecond\n", CompressionNone},
+
+		{"gzip", "\x1f\x8b\x08\x00", CompressionGzip},
+		{"gzip magic only", "\x1f\x8b", CompressionGzip},
+		{"gzip short", "\x1f", CompressionNone},
+		{"gzip second byte", "\x1f\x8c\x08\x00", CompressionNone},
+
+		{"zstd", "\x28\xb5\x2f\xfd\x04\x00", CompressionZstd},
+		{"zstd short", "\x28\xb5\x2f", CompressionNone},
+		{"zstd last byte", "\x28\xb5\x2f\xfe\x04\x00", CompressionNone},
+		{"zstd skippable frame", "\x50\x2a\x4d\x18\x04\x00", CompressionNone},
+
+		{"xz", "\xfd7zXZ\x00\x00\x04", CompressionXz},
+		{"xz short", "\xfd7zXZ", CompressionNone},
+		{"xz without zero", "\xfd7zXZ\x01\x00\x04", CompressionNone},
+		{"7z", "7z\xbc\xaf\x27\x1c", CompressionNone},
+
+		{"bzip2 block", "BZh91AY&SY\x00", CompressionBzip2},
+		{"bzip2 block size 1", "BZh11AY&SY", CompressionBzip2},
+		{"bzip2 empty stream", "BZh9\x17\x72\x45\x38\x50\x90\x00\x00\x00\x00", CompressionBzip2},
+		{"bzip2 block size 0", "BZh01AY&SY", CompressionNone},
+		{"bzip2 block size letter", "BZha1AY&SY", CompressionNone},
+		{"bzip2 text", "BZh text line\n", CompressionNone},
+		{"bzip2 short", "BZh91AY&S", CompressionNone},
+		{"bzip2 block magic", "BZh91AY&SZ", CompressionNone},
+		{"bzip2 end magic", "BZh9\x17\x72\x45\x38\x50\x91", CompressionNone},
+		{"bzip1", "BZ0", CompressionNone},
+	}
+
+	for _, test := range tests {
+
+		compression, r, err := Detect(strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if compression != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, compression, test.want)
+		}
+
+		// the peeked bytes are read again
+		data, err := ioutil.ReadAll(r)
+		if err != nil || string(data) != test.input {
+			t.Errorf("%s: read %q, %v, want the input", test.name, data, err)
+		}
+	}
+}
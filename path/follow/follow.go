@@ -0,0 +1,362 @@
+// Package follow delivers the lines appended to a file like tail -F, it
+// survives truncation and rotation of the file.
+//
+//	err := follow.Follow(ctx, "/var/log/audit.log", follow.Config{
+//		Poll:       5 * time.Second,
+//		OffsetFile: "/var/lib/app/audit.offset",
+//	}, func(n int, line string) error {
+//		return handle(line)
+//	})
+//
+// Changes are noticed by plugin/watcher, including a rename followed by a
+// new file. The optional polling catches changes the watcher misses, e.g.
+// on network file systems.
+package follow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/kernelschmelze/pkg/logger"
+	"github.com/kernelschmelze/pkg/path"
+	"github.com/kernelschmelze/pkg/plugin/watcher"
+)
+
+// defaultPoll is used when the file can't be watched and polling is
+// disabled.
+const defaultPoll = time.Second
+
+var log = logger.Named("follow")
+
+type Config struct {
+	FromStart     bool          // start at the beginning instead of the end
+	Poll          time.Duration // polling interval, 0 relies on the watcher
+	OffsetFile    string        // persists the offset to resume after a restart
+	MaxLineLength int           // defaults to utils.DefaultMaxLineLength
+}
+
+// state is persisted to the offset file.
+type state struct {
+	ID     uint64 `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+type follower struct {
+	config  Config
+	path    string
+	fn      utils.LineFunc
+	file    *os.File
+	info    os.FileInfo
+	offset  int64  // offset of the next line
+	pending []byte // incomplete last line
+	line    int
+}
+
+// Follow calls fn for every line appended to the file at path until ctx is
+// done or fn returns an error, utils.ErrStop stops without error. A missing
+// file is awaited. Only complete lines are delivered, except the last line
+// of a rotated file.
+func Follow(ctx context.Context, path string, config Config, fn utils.LineFunc) error {
+
+	if config.MaxLineLength <= 0 {
+		config.MaxLineLength = utils.DefaultMaxLineLength
+	}
+
+	f := &follower{
+		config: config,
+		path:   path,
+		fn:     fn,
+	}
+
+	defer f.close()
+
+	notify := make(chan struct{}, 1)
+
+	// every event counts, a rewrite with the same content is a new line
+	cancel, err := watcher.Subscribe(path, func(string) {
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}, false)
+
+	if err == nil {
+		defer cancel()
+	}
+
+	poll := config.Poll
+	if err != nil && poll <= 0 {
+		poll = defaultPoll
+	}
+
+	var tick <-chan time.Time
+	if poll > 0 {
+		ticker := time.NewTicker(poll)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	resume := true
+
+	for {
+
+		if err := f.check(resume); err != nil {
+			return f.result(err)
+		}
+
+		resume = false
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-notify:
+		case <-tick:
+		}
+
+	}
+
+}
+
+// check opens the file, handles rotation and truncation and delivers the
+// new lines.
+func (f *follower) check(resume bool) error {
+
+	info, err := os.Stat(f.path)
+
+	if err != nil {
+
+		if !os.IsNotExist(err) {
+			return err
+		}
+
+		// rotated away, the new file isn't there yet
+		if f.file != nil {
+			return f.drain()
+		}
+
+		return nil
+	}
+
+	if f.file != nil && !os.SameFile(f.info, info) {
+
+		log.Debugf("%s rotated", f.path)
+
+		if err := f.drain(); err != nil {
+			return err
+		}
+	}
+
+	if f.file == nil {
+		return f.open(info, resume)
+	}
+
+	if info.Size() < f.offset+int64(len(f.pending)) {
+
+		log.Debugf("%s truncated", f.path)
+
+		f.offset = 0
+		f.pending = nil
+
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	f.info = info
+
+	return f.read()
+}
+
+func (f *follower) open(info os.FileInfo, resume bool) error {
+
+	file, err := os.Open(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// the file may have been replaced between stat and open
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.info = info
+	f.offset = 0
+	f.pending = nil
+
+	switch {
+
+	case resume && f.resume(info):
+
+	case resume && !f.config.FromStart:
+		f.offset = info.Size()
+
+	}
+
+	if _, err := file.Seek(f.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	return f.read()
+}
+
+// resume restores the offset of the offset file if it belongs to the file.
+func (f *follower) resume(info os.FileInfo) bool {
+
+	if len(f.config.OffsetFile) == 0 {
+		return false
+	}
+
+	data, err := ioutil.ReadFile(f.config.OffsetFile)
+	if err != nil {
+		return false
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		log.Warnf("read offset %s failed: %s", f.config.OffsetFile, err)
+		return false
+	}
+
+	if s.ID != fileID(info) || s.Offset > info.Size() {
+		return false
+	}
+
+	f.offset = s.Offset
+
+	return true
+}
+
+// read delivers the complete lines up to the end of the file.
+func (f *follower) read() error {
+
+	buf := make([]byte, 32*1024)
+
+	for {
+
+		n, err := f.file.Read(buf)
+
+		if n > 0 {
+			if lerr := f.split(buf[:n]); lerr != nil {
+				return lerr
+			}
+		}
+
+		if err == io.EOF {
+			return f.save()
+		}
+
+		if err != nil {
+			return err
+		}
+
+	}
+
+}
+
+// split delivers the complete lines of data, the rest is kept pending.
+func (f *follower) split(data []byte) error {
+
+	f.pending = append(f.pending, data...)
+
+	for {
+
+		i := bytes.IndexByte(f.pending, '\n')
+
+		if i < 0 {
+			if len(f.pending) > f.config.MaxLineLength+1 {
+				return &utils.LineTooLongError{Line: f.line + 1, Max: f.config.MaxLineLength}
+			}
+			return nil
+		}
+
+		err := f.deliver(f.pending[:i])
+
+		f.offset += int64(i + 1)
+		f.pending = f.pending[i+1:]
+
+		if err != nil {
+			return err
+		}
+	}
+
+}
+
+func (f *follower) deliver(line []byte) error {
+
+	line = bytes.TrimSuffix(line, []byte("\r"))
+
+	if len(line) > f.config.MaxLineLength {
+		return &utils.LineTooLongError{Line: f.line + 1, Max: f.config.MaxLineLength}
+	}
+
+	f.line++
+
+	return f.fn(f.line, string(line))
+}
+
+// drain delivers the rest of a rotated file, including an unterminated
+// last line, and closes it.
+func (f *follower) drain() error {
+
+	err := f.read()
+
+	if err == nil && len(f.pending) > 0 {
+		err = f.deliver(f.pending)
+	}
+
+	f.close()
+	f.file = nil
+	f.pending = nil
+	f.offset = 0
+
+	return err
+}
+
+// save persists the offset of the next line.
+func (f *follower) save() error {
+
+	if len(f.config.OffsetFile) == 0 || f.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(state{ID: fileID(f.info), Offset: f.offset})
+	if err != nil {
+		return err
+	}
+
+	tmp := f.config.OffsetFile + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.config.OffsetFile)
+}
+
+func (f *follower) close() {
+
+	if f.file != nil {
+		f.file.Close()
+	}
+
+}
+
+func (f *follower) result(err error) error {
+
+	if err == utils.ErrStop {
+		f.save()
+		return nil
+	}
+
+	return err
+}
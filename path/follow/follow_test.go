@@ -0,0 +1,225 @@
+package follow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/path"
+)
+
+// appendFile appends s to the file, it is created if it is missing.
+func appendFile(t *testing.T, file, s string) {
+
+	t.Helper()
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if _, err := f.WriteString(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// start follows the file until the test has finished, the lines are sent to
+// the returned channel.
+func start(t *testing.T, file string, config Config) <-chan string {
+
+	t.Helper()
+
+	lines := make(chan string, 64)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+
+	go func() {
+		done <- Follow(ctx, file, config, func(n int, line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+
+	t.Cleanup(func() {
+
+		cancel()
+
+		if err := <-done; err != context.Canceled {
+			t.Errorf("follow returned %v, want %v", err, context.Canceled)
+		}
+	})
+
+	// let the follower open the file
+	time.Sleep(100 * time.Millisecond)
+
+	return lines
+}
+
+func expect(t *testing.T, lines <-chan string, want ...string) {
+
+	t.Helper()
+
+	for _, w := range want {
+		select {
+		case got := <-lines:
+			if got != w {
+				t.Fatalf("got %q, want %q", got, w)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout waiting for %q", w)
+		}
+	}
+}
+
+func expectNone(t *testing.T, lines <-chan string) {
+
+	t.Helper()
+
+	select {
+	case got := <-lines:
+		t.Fatalf("unexpected line %q", got)
+	case <-time.After(700 * time.Millisecond):
+	}
+}
+
+func TestFollow(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, file, "old\n")
+
+	lines := start(t, file, Config{})
+
+	// only complete lines appended after the start are delivered
+	appendFile(t, file, "first\r\nsec")
+	expect(t, lines, "first")
+
+	appendFile(t, file, "ond\n")
+	expect(t, lines, "second")
+	expectNone(t, lines)
+}
+
+func TestFollowTruncate(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, file, "first\nsecond\n")
+
+	lines := start(t, file, Config{FromStart: true})
+	expect(t, lines, "first", "second")
+
+	// shorter than the offset, read again from the start
+	if err := os.WriteFile(file, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, lines, "new")
+
+	appendFile(t, file, "next\n")
+	expect(t, lines, "next")
+}
+
+func TestFollowRotate(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "app.log")
+	appendFile(t, file, "")
+
+	lines := start(t, file, Config{})
+
+	appendFile(t, file, "first\nlast")
+	expect(t, lines, "first")
+
+	// the unterminated last line of the rotated file is delivered, the new
+	// file is read from the start
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	expect(t, lines, "last")
+
+	appendFile(t, file, "new\n")
+	expect(t, lines, "new")
+
+	appendFile(t, file+".1", "lost\n")
+	appendFile(t, file, "next\n")
+	expect(t, lines, "next")
+}
+
+func TestFollowResume(t *testing.T) {
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.log")
+	offset := filepath.Join(dir, "app.offset")
+
+	appendFile(t, file, "first\nsecond\nthird\n")
+
+	var got []string
+
+	err := Follow(context.Background(), file, Config{FromStart: true, OffsetFile: offset}, func(n int, line string) error {
+		got = append(got, line)
+		if line == "second" {
+			return utils.ErrStop
+		}
+		return nil
+	})
+
+	if err != nil || len(got) != 2 {
+		t.Fatalf("got %q, %v, want 2 lines without error", got, err)
+	}
+
+	// resumed after the last delivered line, FromStart is ignored
+	appendFile(t, file, "fourth\n")
+
+	lines := start(t, file, Config{FromStart: true, OffsetFile: offset})
+	expect(t, lines, "third", "fourth")
+}
+
+func TestFollowResumeOtherFile(t *testing.T) {
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.log")
+	offset := filepath.Join(dir, "app.offset")
+
+	appendFile(t, file, "first\n")
+
+	err := Follow(context.Background(), file, Config{FromStart: true, OffsetFile: offset}, func(int, string) error {
+		return utils.ErrStop
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the offset belongs to the replaced file
+	if err := os.Rename(file, file+".1"); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, file, "other\n")
+
+	lines := start(t, file, Config{OffsetFile: offset})
+
+	appendFile(t, file, "next\n")
+	expect(t, lines, "next")
+}
+
+func TestFollowPoll(t *testing.T) {
+
+	dir := filepath.Join(t.TempDir(), "missing")
+	file := filepath.Join(dir, "app.log")
+
+	// the folder is missing, the file can't be watched and is polled
+	lines := start(t, file, Config{FromStart: true})
+
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	appendFile(t, file, "first\n")
+	expect(t, lines, "first")
+
+	appendFile(t, file, "second\n")
+	expect(t, lines, "second")
+}
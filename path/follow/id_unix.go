@@ -0,0 +1,18 @@
+//go:build unix
+
+package follow
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID returns the inode of the file.
+func fileID(info os.FileInfo) uint64 {
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(stat.Ino)
+	}
+
+	return 0
+}
@@ -2,15 +2,60 @@ package utils
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
+// DefaultMaxLineLength limits the lines of a LineReader without limit.
+const DefaultMaxLineLength = 16 << 20
+
+// ErrStop is returned by a LineFunc to stop reading without error.
+var ErrStop = errors.New("stop reading")
+
+// LineTooLongError is returned for a line exceeding the maximum length.
+type LineTooLongError struct {
+	Line int
+	Max  int
+}
+
+func (e *LineTooLongError) Error() string {
+	return fmt.Sprintf("line %d exceeds %d bytes", e.Line, e.Max)
+}
+
+// LineFunc receives the lines with their number, starting at 1. Returning
+// ErrStop stops reading, any other error is returned by the reader.
+type LineFunc func(n int, line string) error
+
+// LineReader reads lines terminated by LF or CRLF, the last line doesn't
+// need a terminator. Compressed input is decompressed transparently.
+type LineReader struct {
+	MaxLineLength int         // defaults to DefaultMaxLineLength
+	Compression   Compression // defaults to CompressionAuto
+}
+
+// ReadLine calls fn for every line of the file at path.
 func ReadLine(path string, fn func(line string)) error {
 
 	if fn == nil {
 		return nil
 	}
 
+	return ReadLines(context.Background(), path, func(n int, line string) error {
+		fn(line)
+		return nil
+	})
+}
+
+// ReadLines calls fn for every line of the file at path until ctx is done.
+func ReadLines(ctx context.Context, path string, fn LineFunc) error {
+	return LineReader{}.ReadFile(ctx, path, fn)
+}
+
+func (r LineReader) ReadFile(ctx context.Context, path string, fn LineFunc) error {
+
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
 	if err != nil {
 		return err
@@ -18,11 +63,105 @@ func ReadLine(path string, fn func(line string)) error {
 
 	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		fn(scanner.Text())
+	return r.Read(ctx, f, fn)
+}
+
+// Read calls fn for every line of rd until ctx is done, it returns the
+// error of the context then.
+func (r LineReader) Read(ctx context.Context, rd io.Reader, fn LineFunc) error {
+
+	if fn == nil {
+		return nil
+	}
+
+	max := r.MaxLineLength
+	if max <= 0 {
+		max = DefaultMaxLineLength
+	}
+
+	dec, err := Decompress(rd, r.Compression)
+	if err != nil {
+		return err
+	}
+
+	defer dec.Close()
+
+	br := bufio.NewReader(dec)
+
+	for n := 1; ; n++ {
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		line, err := readLine(br, max)
+
+		switch {
+		case err == errLineTooLong:
+			return &LineTooLongError{Line: n, Max: max}
+		case err == io.EOF && len(line) == 0:
+			return nil
+		case err != nil && err != io.EOF:
+			return err
+		}
+
+		if ferr := fn(n, line); ferr != nil {
+			if ferr == ErrStop {
+				return nil
+			}
+			return ferr
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+	}
+
+}
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine returns the next line without terminator, io.EOF is returned
+// with the last line if it isn't terminated.
+func readLine(br *bufio.Reader, max int) (string, error) {
+
+	var line []byte
+
+	for {
+
+		chunk, err := br.ReadSlice('\n')
+
+		if len(line)+len(chunk) > max+2 {
+			return "", errLineTooLong
+		}
+
+		line = append(line, chunk...)
+
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		line = trimEOL(line)
+
+		if len(line) > max {
+			return "", errLineTooLong
+		}
+
+		return string(line), err
+	}
+
+}
+
+func trimEOL(line []byte) []byte {
+
+	if n := len(line); n > 0 && line[n-1] == '\n' {
+		line = line[:n-1]
+	}
+
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
 	}
 
-	err = scanner.Err()
-	return err
+	return line
 }
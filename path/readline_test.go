@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// readAll returns the lines of r and checks their numbers.
+func readAll(t *testing.T, r LineReader, rd io.Reader) ([]string, error) {
+
+	t.Helper()
+
+	var lines []string
+
+	err := r.Read(context.Background(), rd, func(n int, line string) error {
+		if n != len(lines)+1 {
+			t.Fatalf("line %d numbered %d", len(lines)+1, n)
+		}
+		lines = append(lines, line)
+		return nil
+	})
+
+	return lines, err
+}
+
+func equal(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestLineReader(t *testing.T) {
+
+	tests := []struct {
+		input string
+		lines []string
+	}{
+		{"", nil},
+		{"\n", []string{""}},
+		{"first\nsecond\r\nthird", []string{"first", "second", "third"}},
+		{"first\n\nthird\n", []string{"first", "", "third"}},
+		{"carriage\rreturn\r\n", []string{"carriage\rreturn"}},
+	}
+
+	for _, test := range tests {
+
+		lines, err := readAll(t, LineReader{}, strings.NewReader(test.input))
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+
+		if !equal(lines, test.lines) {
+			t.Errorf("%q: got %q, want %q", test.input, lines, test.lines)
+		}
+	}
+}
+
+func TestMaxLineLength(t *testing.T) {
+
+	r := LineReader{MaxLineLength: 8}
+
+	// the terminator doesn't count
+	lines, err := readAll(t, r, strings.NewReader("12345678\r\n1234567\n12345678"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"12345678", "1234567", "12345678"}; !equal(lines, want) {
+		t.Fatalf("got %q, want %q", lines, want)
+	}
+
+	for _, input := range []string{
+		"ok\n123456789\n",
+		"ok\n123456789",
+		"ok\n" + strings.Repeat("x", 64<<10) + "\n",
+	} {
+
+		lines, err := readAll(t, r, strings.NewReader(input))
+
+		var tooLong *LineTooLongError
+		if !errors.As(err, &tooLong) || tooLong.Line != 2 || tooLong.Max != 8 {
+			t.Fatalf("got %v, want line 2 exceeding 8 bytes", err)
+		}
+
+		if len(lines) != 1 {
+			t.Fatalf("got %d lines before the error, want 1", len(lines))
+		}
+	}
+}
+
+func TestLineReaderStop(t *testing.T) {
+
+	var lines []string
+
+	err := LineReader{}.Read(context.Background(), strings.NewReader("a\nb\nc\n"), func(n int, line string) error {
+		lines = append(lines, line)
+		if n == 2 {
+			return ErrStop
+		}
+		return nil
+	})
+
+	if err != nil || !equal(lines, []string{"a", "b"}) {
+		t.Fatalf("got %q, %v, want 2 lines without error", lines, err)
+	}
+
+	// other errors are returned
+	failed := errors.New("failed")
+
+	err = LineReader{}.Read(context.Background(), strings.NewReader("a\nb\n"), func(int, string) error {
+		return failed
+	})
+
+	if err != failed {
+		t.Fatalf("got %v, want %v", err, failed)
+	}
+
+	// a cancelled context stops reading
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = LineReader{}.Read(ctx, strings.NewReader("a\n"), func(int, string) error {
+		t.Fatal("line read after cancel")
+		return nil
+	})
+
+	if err != context.Canceled {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+}
+
+// bzip2Text is "first\nsecond\r\nthird" compressed by bzip2 -9.
+const bzip2Text = "425a6839314159265359fc3ae02a000003c18000120f619c002000228c21e8f5" +
+	"080680068956476a8b3424d82ee48a70a121f875c054"
+
+func TestLineReaderCompressed(t *testing.T) {
+
+	const text = "first\nsecond\r\nthird"
+
+	want := []string{"first", "second", "third"}
+
+	compress := map[Compression]func(w io.Writer) (io.WriteCloser, error){
+		CompressionGzip: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		CompressionZstd: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w)
+		},
+		CompressionXz: func(w io.Writer) (io.WriteCloser, error) {
+			return xz.NewWriter(w)
+		},
+	}
+
+	inputs := map[Compression][]byte{}
+
+	for compression, newWriter := range compress {
+
+		var buf bytes.Buffer
+
+		w, err := newWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := io.WriteString(w, text); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		inputs[compression] = buf.Bytes()
+	}
+
+	bz, err := hex.DecodeString(bzip2Text)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputs[CompressionBzip2] = bz
+
+	for compression, data := range inputs {
+
+		// detected and selected explicitly
+		for _, r := range []LineReader{{}, {Compression: compression}} {
+
+			lines, err := readAll(t, r, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("compression %d: %v", compression, err)
+			}
+
+			if !equal(lines, want) {
+				t.Fatalf("compression %d: got %q, want %q", compression, lines, want)
+			}
+		}
+
+		// the limit applies to the decompressed lines
+		_, err := readAll(t, LineReader{MaxLineLength: 5}, bytes.NewReader(data))
+
+		var tooLong *LineTooLongError
+		if !errors.As(err, &tooLong) || tooLong.Line != 2 {
+			t.Fatalf("compression %d: got %v, want line 2 too long", compression, err)
+		}
+	}
+
+	// corrupt input fails
+	corrupt := append([]byte(nil), inputs[CompressionGzip][:12]...)
+
+	if _, err := readAll(t, LineReader{}, bytes.NewReader(corrupt)); err == nil {
+		t.Fatal("truncated gzip read without error")
+	}
+}
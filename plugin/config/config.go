@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/kernelschmelze/pkg/logger"
 	"github.com/kernelschmelze/pkg/path"
 	manager "github.com/kernelschmelze/pkg/plugin/manager"
 	"github.com/kernelschmelze/pkg/plugin/watcher"
@@ -20,6 +21,7 @@ import (
 
 var (
 	config *Config
+	log    = logger.Named("config")
 )
 
 func init() {
@@ -64,7 +66,9 @@ func Read(path string) error {
 	err = config.Read(path)
 
 	wErr := watcher.Add(path, func(file string) {
-		config.Read(file)
+		if err := config.Read(file); err != nil {
+			log.Errorf("reload %s failed: %s", file, err)
+		}
 	})
 
 	if err == nil {
@@ -117,9 +121,14 @@ func (c *Config) Read(path string) error {
 				continue
 			}
 
+			if err := cfg.Unmarshal(config); err != nil {
+				log.Errorf("unmarshal config of %s failed: %s", name, err)
+				continue
+			}
+
+			// a failed section is unmarshaled again on the next read
 			c.hash[name] = hash[:]
 
-			cfg.Unmarshal(config)
 			update[plugin] = config
 
 		}
@@ -133,7 +142,10 @@ func (c *Config) Read(path string) error {
 	c.mu.Unlock()
 
 	for plugin, config := range update {
-		manager.GetManager().ConfigurePlugin(plugin, config)
+		log.Debugf("configure %s from %s", getName(plugin), path)
+		if err := manager.GetManager().ConfigurePlugin(plugin, config); err != nil {
+			log.Warn(err)
+		}
 	}
 
 	return err
@@ -177,6 +189,10 @@ func (c *Config) Write(plugin interface{}, key string, value interface{}) error
 		err = os.Rename(tmp, configFile)
 	}
 
+	if err != nil {
+		log.Errorf("write %s to %s failed: %s", strings.Join(path, "."), configFile, err)
+	}
+
 	return err
 }
 
@@ -1,12 +1,19 @@
 package plugin
 
 import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/kernelschmelze/pkg/logger"
 	"github.com/kernelschmelze/pkg/plugin/plugin"
 )
 
 type Message struct {
 	Action  string
 	Payload interface{}
+
+	ctx context.Context
 }
 
 func NewMessage(action string, v interface{}) Message {
@@ -15,34 +22,81 @@ func NewMessage(action string, v interface{}) Message {
 	return msg
 }
 
-func (m *Manager) Dispatch(v interface{}) {
+// NewMessageContext returns a message which carries ctx to the plugins.
+func NewMessageContext(ctx context.Context, action string, v interface{}) Message {
+	msg := NewMessage(action, v)
+	msg.ctx = ctx
+	return msg
+}
 
-	if !m.activated.IsSet() {
-		return
+// Context returns the context of the message, the dispatcher adds the
+// message id to it.
+func (m Message) Context() context.Context {
+	if m.ctx == nil {
+		return context.Background()
 	}
+	return m.ctx
+}
 
-	switch v.(type) {
+func (m *Manager) Dispatch(v interface{}) {
+	m.dispatch(nil, v, true)
+}
 
-	case Message:
-		m.jobs <- v.(Message)
+// DispatchContext dispatches v like Dispatch, the plugins receive ctx
+// extended by the message id and their plugin name.
+func (m *Manager) DispatchContext(ctx context.Context, v interface{}) {
+	m.dispatch(ctx, v, true)
+}
 
-	default:
+// TryDispatchContext dispatches v like DispatchContext but never blocks,
+// it reports if the message has been queued.
+func (m *Manager) TryDispatchContext(ctx context.Context, v interface{}) bool {
+	return m.dispatch(ctx, v, false)
+}
+
+func (m *Manager) dispatch(ctx context.Context, v interface{}, block bool) bool {
 
-		msg := Message{}
+	if !m.activated.IsSet() {
+		return false
+	}
+
+	msg, ok := v.(Message)
+	if !ok {
+		msg = Message{}
 		msg.Payload = v
+	}
+
+	if ctx != nil {
+		msg.ctx = ctx
+	}
 
+	id := atomic.AddUint64(&m.messageID, 1)
+	msg.ctx = logger.WithContext(msg.Context(), logger.MessageID(strconv.FormatUint(id, 10)))
+
+	if block {
 		m.jobs <- msg
+		return true
+	}
 
+	select {
+	case m.jobs <- msg:
+		return true
+	default:
+		return false
 	}
 }
 
 func (m *Manager) Do(v interface{}) error {
+	return m.DoContext(context.Background(), v)
+}
+
+func (m *Manager) DoContext(ctx context.Context, v interface{}) error {
 
 	var err error
 
 	m.plugins.Each(func(plugin plugin.PluginInterface) {
 		if err == nil && plugin.IsActivated() {
-			err = plugin.Do(v)
+			err = m.doPlugin(ctx, plugin, "", v)
 		}
 	})
 
@@ -50,18 +104,44 @@ func (m *Manager) Do(v interface{}) error {
 }
 
 func (m *Manager) DoAction(action string, v interface{}) error {
+	return m.DoActionContext(context.Background(), action, v)
+}
+
+func (m *Manager) DoActionContext(ctx context.Context, action string, v interface{}) error {
 
 	var err error
 
 	m.plugins.Each(func(plugin plugin.PluginInterface) {
 		if err == nil {
-			err = plugin.DoAction(action, v)
+			err = m.doPlugin(ctx, plugin, action, v)
 		}
 	})
 
 	return err
 }
 
+func (m *Manager) doPlugin(ctx context.Context, p plugin.PluginInterface, action string, v interface{}) error {
+
+	cp, ok := p.(plugin.ContextPluginInterface)
+
+	// a plugin embedding PluginBase without a context callback may
+	// override Do or DoAction
+	if !ok || !cp.WantsContext(action) {
+		if len(action) == 0 {
+			return p.Do(v)
+		}
+		return p.DoAction(action, v)
+	}
+
+	ctx = logger.WithContext(ctx, logger.Plugin(m.plugins.GetName(p)))
+
+	if len(action) == 0 {
+		return cp.DoContext(ctx, v)
+	}
+
+	return cp.DoActionContext(ctx, action, v)
+}
+
 func (m *Manager) dispatcher() {
 
 	defer m.wg.Done()
@@ -75,13 +155,19 @@ func (m *Manager) dispatcher() {
 
 		case msg := <-m.jobs:
 
+			ctx := msg.Context()
+
 			if len(msg.Action) == 0 {
 
-				m.Do(msg.Payload)
+				if err := m.DoContext(ctx, msg.Payload); err != nil {
+					log.With(logger.ContextFields(ctx)...).Warnf("dispatch %T failed: %s", msg.Payload, err)
+				}
 
 			} else {
 
-				m.DoAction(msg.Action, msg.Payload)
+				if err := m.DoActionContext(ctx, msg.Action, msg.Payload); err != nil {
+					log.With(logger.ContextFields(ctx)...).Warnf("dispatch action %s failed: %s", msg.Action, err)
+				}
 
 			}
 
@@ -0,0 +1,137 @@
+package plugin_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kernelschmelze/pkg/logger"
+	manager "github.com/kernelschmelze/pkg/plugin/manager"
+	"github.com/kernelschmelze/pkg/plugin/plugin"
+	base "github.com/kernelschmelze/pkg/plugin/plugin/base"
+)
+
+// overrider embeds the base and overrides Do and DoAction like the plugins
+// written before the context was carried.
+type overrider struct {
+	*base.PluginBase
+	received chan string
+}
+
+func (p *overrider) Do(v interface{}) error {
+	p.received <- "do " + v.(string)
+	return nil
+}
+
+func (p *overrider) DoAction(action string, v interface{}) error {
+	p.received <- action + " " + v.(string)
+	return nil
+}
+
+// embedder embeds the empty plugin.Plugin.
+type embedder struct {
+	plugin.Plugin
+	received chan string
+}
+
+func (p *embedder) IsActivated() bool { return true }
+
+func (p *embedder) Do(v interface{}) error {
+	p.received <- "do " + v.(string)
+	return nil
+}
+
+// receive returns the next delivered message.
+func receive(t *testing.T, received chan string) string {
+
+	t.Helper()
+
+	select {
+	case s := <-received:
+		return s
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	return ""
+}
+
+func TestDispatchOverriddenDo(t *testing.T) {
+
+	m := manager.NewManager()
+
+	over := &overrider{PluginBase: base.NewPlugin(), received: make(chan string, 4)}
+	embed := &embedder{received: make(chan string, 4)}
+
+	for _, p := range []plugin.PluginInterface{over, embed} {
+		if err := m.AddPlugin(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m.Start()
+	defer m.Stop()
+
+	m.Dispatch("payload")
+
+	if got := receive(t, over.received); got != "do payload" {
+		t.Errorf("got %q, want the overridden Do", got)
+	}
+
+	if got := receive(t, embed.received); got != "do payload" {
+		t.Errorf("got %q, want the overridden Do of the embedder", got)
+	}
+
+	m.Dispatch(manager.NewMessage("reload", "payload"))
+
+	if got := receive(t, over.received); got != "reload payload" {
+		t.Errorf("got %q, want the overridden DoAction", got)
+	}
+}
+
+func TestDispatchContext(t *testing.T) {
+
+	m := manager.NewManager()
+
+	received := make(chan context.Context, 2)
+
+	p := base.NewPlugin()
+	p.RegisterActionContextCallback("reload", func(ctx context.Context, v interface{}) error {
+		received <- ctx
+		return nil
+	})
+
+	if err := m.AddPlugin(p); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Start()
+	defer m.Stop()
+
+	ctx := logger.WithContext(context.Background(), logger.String("request", "42"))
+	m.DispatchContext(ctx, manager.NewMessage("reload", nil))
+
+	select {
+
+	case ctx := <-received:
+
+		fields := make(map[string]bool)
+		for _, f := range logger.ContextFields(ctx) {
+			fields[f.Key] = true
+		}
+
+		for _, key := range []string{"request", logger.MessageIDFieldName, logger.PluginFieldName} {
+			if !fields[key] {
+				t.Errorf("field %s missing in the context", key)
+			}
+		}
+
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered")
+	}
+
+	// only the registered action is delivered with its context
+	if p.WantsContext("") || p.WantsContext("other") || !p.WantsContext("reload") {
+		t.Error("context wanted for the wrong actions")
+	}
+}
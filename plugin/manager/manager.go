@@ -1,9 +1,11 @@
 package plugin
 
 import (
+	"context"
 	"sync"
 
 	"github.com/kernelschmelze/pkg/atom"
+	"github.com/kernelschmelze/pkg/logger"
 	"github.com/kernelschmelze/pkg/plugin/plugin"
 
 	"github.com/pkg/errors"
@@ -11,9 +13,11 @@ import (
 
 var (
 	manager *Manager
+	log     = logger.Named("manager")
 )
 
 type Manager struct {
+	messageID   uint64 // first field, 64-bit aligned for atomic access
 	activated   atom.Bool
 	plugins     *plugin.PluginList
 	pluginCount int
@@ -64,6 +68,16 @@ func Dispatch(v interface{}) {
 	manager.Dispatch(v)
 }
 
+func DispatchContext(ctx context.Context, v interface{}) {
+	manager := GetManager()
+	manager.DispatchContext(ctx, v)
+}
+
+func TryDispatchContext(ctx context.Context, v interface{}) bool {
+	manager := GetManager()
+	return manager.TryDispatchContext(ctx, v)
+}
+
 func (m *Manager) Start() {
 
 	m.kill = make(chan bool)
@@ -84,6 +98,9 @@ func (m *Manager) Stop() {
 	m.wg.Wait()
 
 	m.stopPlugins()
+
+	// deliver the messages still queued by an asynchronous logger
+	logger.Flush()
 }
 
 func (m *Manager) AddPlugin(plugin plugin.PluginInterface) error {
@@ -124,7 +141,11 @@ func (m *Manager) startPlugins() {
 	m.plugins.SortByPriority()
 	m.plugins.Each(func(plugin plugin.PluginInterface) {
 		if !plugin.IsActivated() {
-			plugin.Start()
+			if err := plugin.Start(); err != nil {
+				log.Errorf("start plugin %s failed: %s", m.plugins.GetName(plugin), err)
+				return
+			}
+			log.Debugf("plugin %s started", m.plugins.GetName(plugin))
 		}
 	})
 }
@@ -133,7 +154,11 @@ func (m *Manager) stopPlugins() {
 
 	m.plugins.EachReverse(func(plugin plugin.PluginInterface) {
 		if plugin.IsActivated() {
-			plugin.Stop()
+			if err := plugin.Stop(); err != nil {
+				log.Errorf("stop plugin %s failed: %s", m.plugins.GetName(plugin), err)
+				return
+			}
+			log.Debugf("plugin %s stopped", m.plugins.GetName(plugin))
 		}
 	})
 }
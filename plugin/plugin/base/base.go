@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"context"
 	"sync"
 
 	"github.com/kernelschmelze/pkg/atom"
@@ -10,6 +11,7 @@ import (
 
 type cbGeneric func() error
 type cbDo func(v interface{}) error
+type cbDoContext func(ctx context.Context, v interface{}) error
 type cbConfig func(v interface{})
 
 func NewPlugin() *PluginBase {
@@ -18,8 +20,9 @@ func NewPlugin() *PluginBase {
 
 func NewPluginWithPriority(priority int) *PluginBase {
 	p := &PluginBase{
-		priority: priority,
-		action:   make(map[string]cbDo),
+		priority:      priority,
+		action:        make(map[string]cbDo),
+		actionContext: make(map[string]cbDoContext),
 	}
 	return p
 }
@@ -30,18 +33,21 @@ type PluginConfig struct {
 	OnStop      cbGeneric
 	OnConfigure cbConfig
 	OnDo        cbDo
+	OnDoContext cbDoContext
 	Config      interface{}
 }
 
 type PluginBase struct {
-	priority    int
-	action      map[string]cbDo
-	guard       sync.RWMutex
-	activated   atom.Bool
-	onStart     cbGeneric
-	onStop      cbGeneric
-	onDo        cbDo
-	onConfigure cbConfig
+	priority      int
+	action        map[string]cbDo
+	actionContext map[string]cbDoContext
+	guard         sync.RWMutex
+	activated     atom.Bool
+	onStart       cbGeneric
+	onStop        cbGeneric
+	onDo          cbDo
+	onDoContext   cbDoContext
+	onConfigure   cbConfig
 }
 
 func (p *PluginBase) Init(callback PluginConfig) error {
@@ -50,6 +56,7 @@ func (p *PluginBase) Init(callback PluginConfig) error {
 	p.onStop = callback.OnStop
 	p.onConfigure = callback.OnConfigure
 	p.onDo = callback.OnDo
+	p.onDoContext = callback.OnDoContext
 
 	if err := plugin.RegisterPlugin(callback.Plugin, p.priority); err != nil {
 		return err
@@ -76,10 +83,41 @@ func (p *PluginBase) RegisterActionCallback(action string, callback cbDo) {
 
 	p.guard.Lock()
 	p.action[action] = callback
+	delete(p.actionContext, action)
 	p.guard.Unlock()
 
 }
 
+// RegisterActionContextCallback registers a callback which receives the
+// context of the message, DoContext if callback is nil.
+func (p *PluginBase) RegisterActionContextCallback(action string, callback cbDoContext) {
+
+	if callback == nil {
+		callback = p.DoContext
+	}
+
+	p.guard.Lock()
+	p.actionContext[action] = callback
+	delete(p.action, action)
+	p.guard.Unlock()
+
+}
+
+// WantsContext reports if a context callback is registered for the action,
+// an empty action stands for Do.
+func (p *PluginBase) WantsContext(action string) bool {
+
+	if len(action) == 0 {
+		return p.onDoContext != nil
+	}
+
+	p.guard.RLock()
+	_, exist := p.actionContext[action]
+	p.guard.RUnlock()
+
+	return exist
+}
+
 func (p *PluginBase) Start() error {
 
 	if p.onStart != nil {
@@ -118,6 +156,14 @@ func (p *PluginBase) Configure(v interface{}) {
 }
 
 func (p *PluginBase) Do(v interface{}) error {
+	return p.DoContext(context.Background(), v)
+}
+
+func (p *PluginBase) DoContext(ctx context.Context, v interface{}) error {
+
+	if p.onDoContext != nil {
+		return p.onDoContext(ctx, v)
+	}
 
 	if p.onDo != nil {
 		return p.onDo(v)
@@ -127,15 +173,30 @@ func (p *PluginBase) Do(v interface{}) error {
 }
 
 func (p *PluginBase) DoAction(action string, v interface{}) error {
+	return p.doAction(context.Background(), action, v)
+}
+
+func (p *PluginBase) DoActionContext(ctx context.Context, action string, v interface{}) error {
+	return p.doAction(ctx, action, v)
+}
+
+func (p *PluginBase) doAction(ctx context.Context, action string, v interface{}) error {
 
 	var err error
 
 	p.guard.RLock()
 	callback, exist := p.action[action]
+	callbackContext, existContext := p.actionContext[action]
 	p.guard.RUnlock()
 
-	if exist && callback != nil {
+	switch {
+
+	case exist && callback != nil:
 		err = callback(v)
+
+	case existContext && callbackContext != nil:
+		err = callbackContext(ctx, v)
+
 	}
 
 	return err
@@ -1,5 +1,9 @@
 package plugin
 
+import (
+	"context"
+)
+
 type PluginInterface interface {
 	Start() error
 	Stop() error
@@ -9,6 +13,16 @@ type PluginInterface interface {
 	DoAction(action string, v interface{}) error
 }
 
+// ContextPluginInterface is implemented by plugins which want to receive
+// the context of a dispatched message. The manager calls DoContext or
+// DoActionContext only if WantsContext reports true for the action, an
+// empty action stands for Do, otherwise Do or DoAction is called.
+type ContextPluginInterface interface {
+	WantsContext(action string) bool
+	DoContext(ctx context.Context, v interface{}) error
+	DoActionContext(ctx context.Context, action string, v interface{}) error
+}
+
 type Plugin struct{}
 
 func (p *Plugin) Start() error                       { return nil }
@@ -10,6 +10,8 @@ import (
 	"golang.org/x/crypto/blake2b"
 
 	"github.com/kernelschmelze/pkg/atom"
+	"github.com/kernelschmelze/pkg/clock"
+	"github.com/kernelschmelze/pkg/logger"
 	"github.com/kernelschmelze/pkg/path"
 
 	"github.com/fsnotify/fsnotify"
@@ -17,16 +19,27 @@ import (
 
 type cbChanged func(file string)
 
+// subscription is a registered callback, dedup skips changes which leave
+// the content unchanged.
+type subscription struct {
+	fn    cbChanged
+	dedup bool
+}
+
 type Watcher struct {
 	Watcher     *fsnotify.Watcher
 	running     atom.Bool
-	notify      map[string][]cbChanged
+	notify      map[string][]*subscription
+	folders     map[string]bool // watched to catch missing or rotated files
 	notifyGuard sync.RWMutex
+	startGuard  sync.Mutex
 	wg          *sync.WaitGroup
+	clock       clock.Clock
 }
 
 var (
 	watcher *Watcher
+	log     = logger.Named("watcher")
 )
 
 func init() {
@@ -36,11 +49,16 @@ func init() {
 func NewWatcher() *Watcher {
 
 	w := &Watcher{
-		wg:     &sync.WaitGroup{},
-		notify: make(map[string][]cbChanged),
+		wg:      &sync.WaitGroup{},
+		notify:  make(map[string][]*subscription),
+		folders: make(map[string]bool),
+		clock:   clock.System,
 	}
 
-	w.Watcher, _ = fsnotify.NewWatcher()
+	var err error
+	if w.Watcher, err = fsnotify.NewWatcher(); err != nil {
+		log.Errorf("create watcher failed: %s", err)
+	}
 
 	return w
 }
@@ -61,6 +79,12 @@ func Add(file string, fn cbChanged) error {
 	return err
 }
 
+func Subscribe(file string, fn cbChanged, dedup bool) (cancel func(), err error) {
+
+	watcher := GetWatcher()
+	return watcher.Subscribe(file, fn, dedup)
+}
+
 func Remove(file string) error {
 
 	watcher := GetWatcher()
@@ -74,97 +98,185 @@ func Close() {
 	watcher.Stop()
 }
 
+// SetClock sets the clock of the debounce timer, it has to be called
+// before the watcher is started.
+func (w *Watcher) SetClock(c clock.Clock) {
+
+	if c == nil {
+		c = clock.System
+	}
+
+	w.clock = c
+}
+
+// Add watches the file and calls fn when its content has changed.
 func (w *Watcher) Add(file string, fn cbChanged) error {
+	_, err := w.Subscribe(file, fn, true)
+	return err
+}
 
-	var err error
+// Subscribe watches the file and calls fn when it has been written,
+// created, removed or renamed. With dedup writes which leave the content
+// unchanged are skipped, this hashes the whole file on every write. cancel
+// removes the subscription, the watches of the file and its folder are
+// removed after the last one.
+func (w *Watcher) Subscribe(file string, fn cbChanged, dedup bool) (cancel func(), err error) {
 
 	// normalize file name
 	if file, err = utils.ExpandPath(file); err != nil {
-		return err
+		return nil, err
 	}
 
+	sub := &subscription{fn: fn, dedup: dedup}
+
+	w.notifyGuard.Lock()
+
 	// add file to watcher
 	if err = w.Watcher.Add(file); err != nil {
 
-		// file does not exist
-		if !utils.Exists(file) {
+		// file does not exist, add folder to watcher
+		if !utils.Exists(file) && utils.Exists(utils.GetFolder(file)) {
+			err = w.watchFolder(file)
+		}
 
-			// add folder to watcher
-			folder := utils.GetFolder(file)
-			if utils.Exists(folder) {
-				err = w.Watcher.Add(folder)
-			}
+	}
 
-		}
+	// register callback function to call if file has been changed
+	if err == nil && fn != nil {
+		w.notify[file] = append(w.notify[file], sub)
+	}
 
-		if err != nil {
-			return err
+	w.notifyGuard.Unlock()
+
+	if err != nil {
+		log.Warnf("watch %s failed: %s", file, err)
+		return nil, err
+	}
+
+	log.Debugf("watch %s", file)
+
+	if !w.running.IsSet() {
+		w.Start()
+	}
+
+	var once sync.Once
+
+	cancel = func() {
+		once.Do(func() {
+			w.unsubscribe(file, sub)
+		})
+	}
+
+	return cancel, nil
+}
+
+// unsubscribe removes the subscription, the last one of the file removes
+// the watch of the file and of its folder if no other file needs it.
+func (w *Watcher) unsubscribe(file string, sub *subscription) {
+
+	w.notifyGuard.Lock()
+	defer w.notifyGuard.Unlock()
+
+	subs := w.notify[file]
+
+	for i := range subs {
+		if subs[i] == sub {
+			subs = append(subs[:i:i], subs[i+1:]...)
+			break
 		}
+	}
 
+	if len(subs) > 0 {
+		w.notify[file] = subs
+		return
 	}
 
-	// register callback function to call if file has been changed
-	if fn != nil {
+	delete(w.notify, file)
+
+	log.Debugf("unwatch %s", file)
+
+	// the file isn't watched if it is missing
+	w.Watcher.Remove(file)
 
-		w.notifyGuard.Lock()
+	folder := utils.GetFolder(file)
+
+	if !w.folders[folder] {
+		return
+	}
 
-		notify, exist := w.notify[file]
-		if !exist {
-			notify = []cbChanged{}
+	for name := range w.notify {
+		if name == folder || utils.GetFolder(name) == folder {
+			return
 		}
-		notify = append(notify, fn)
-		w.notify[file] = notify
+	}
+
+	w.Watcher.Remove(folder)
+	delete(w.folders, folder)
+}
 
-		w.notifyGuard.Unlock()
+// watchFolder watches the folder of the file to catch the file when it is
+// created, the watch is tracked to remove it after the last subscription.
+// The caller holds notifyGuard.
+func (w *Watcher) watchFolder(file string) error {
 
+	folder := utils.GetFolder(file)
+
+	if w.folders[folder] {
+		return nil
 	}
 
-	if !w.running.IsSet() {
-		w.Start()
+	if err := w.Watcher.Add(folder); err != nil {
+		return err
 	}
 
+	w.folders[folder] = true
+
 	return nil
 }
 
 func (w *Watcher) Remove(file string) error {
 	return w.Watcher.Remove(file)
-
 }
 
 func (w *Watcher) Start() {
 
+	// concurrent subscriptions must not start a second event loop
+	w.startGuard.Lock()
+	defer w.startGuard.Unlock()
+
 	if w.Watcher == nil || w.running.IsSet() {
 		return
 	}
 
+	w.running.Set(true)
 	w.wg.Add(1)
 
 	go func() {
 
-		w.running.Set(true)
-
 		defer func() {
 			w.running.Set(false)
 			w.wg.Done()
 		}()
 
-		idle := 60 * time.Minute
-		debounce := idle
+		debounce := 500 * time.Millisecond
 		watcher := w.Watcher
 		hash := make(map[string][]byte)
+
+		// runs only while changes are pending
+		timer := w.clock.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		// changed files, true if the dedup subscribers are skipped
 		files := make(map[string]bool)
 
 		for {
 
 			select {
 
-			case <-time.After(debounce):
-
-				if len(files) == 0 {
-					break
-				}
+			case <-timer.C():
 
-				for file := range files {
+				for file, unchanged := range files {
 
 					w.notifyGuard.RLock()
 					dispatch, exist := w.notify[file]
@@ -176,9 +288,11 @@ func (w *Watcher) Start() {
 
 					// call registered callback function
 
-					for i := range dispatch {
-						if cb := dispatch[i]; cb != nil {
-							cb(file)
+					log.Debugf("%s changed, notify %d subscriber", file, len(dispatch))
+
+					for _, sub := range dispatch {
+						if sub.fn != nil && !(sub.dedup && unchanged) {
+							sub.fn(file)
 						}
 					}
 
@@ -186,8 +300,6 @@ func (w *Watcher) Start() {
 
 				files = make(map[string]bool)
 
-				debounce = idle
-
 			case event, ok := <-watcher.Events:
 
 				if !ok {
@@ -195,12 +307,23 @@ func (w *Watcher) Start() {
 				}
 
 				w.notifyGuard.RLock()
-				_, exist := w.notify[event.Name]
+				subs, exist := w.notify[event.Name]
+				dedup := false
+				for _, sub := range subs {
+					dedup = dedup || sub.dedup
+				}
 				w.notifyGuard.RUnlock()
 
+				if !exist {
+					continue
+				}
+
 				notify := event.Op&fsnotify.Write == fsnotify.Write
+				gone := false
 
-				if event.Op&fsnotify.Remove == fsnotify.Remove && exist {
+				switch {
+
+				case event.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
 
 					if utils.Exists(event.Name) {
 
@@ -212,51 +335,100 @@ func (w *Watcher) Start() {
 
 					} else {
 
-						// add folder to watcher to catch the file again
+						// rotated away, add folder to watcher to catch the
+						// file again unless it has been unsubscribed meanwhile
+
+						w.notifyGuard.Lock()
+						if _, exist := w.notify[event.Name]; exist {
+							w.watchFolder(event.Name)
+						}
+						w.notifyGuard.Unlock()
 
-						folder := utils.GetFolder(event.Name)
-						w.Watcher.Add(folder)
+						notify = true
+						gone = true
 
 					}
 
+				case event.Op&fsnotify.Create == fsnotify.Create:
+
+					// created again, watch the file itself
+					w.Watcher.Add(event.Name)
+					notify = true
+
 				}
 
-				if !notify || !exist {
+				if !notify {
 					continue
 				}
 
-				// compare file hash to prevent multiple trigger
-
-				if hasher, err := blake2b.New256(nil); err == nil {
-					if f, err := os.OpenFile(event.Name, os.O_RDONLY, 0); err == nil {
-						if _, err = io.Copy(hasher, f); err == nil {
-							crc := hasher.Sum(nil)
-							if oldHash, exist := hash[event.Name]; exist && bytes.Equal(crc, oldHash) {
-								f.Close()
-								continue
-							}
-							hash[event.Name] = crc
-						}
-						f.Close()
-					}
+				// there is no content to compare, the dedup subscribers
+				// are notified when the file is created again
+				unchanged := gone
+				if gone {
+					delete(hash, event.Name)
+				}
+
+				// compare file hash to prevent multiple trigger, only if
+				// a subscriber wants it
+
+				if dedup && !gone {
+					unchanged = w.unchanged(hash, event.Name)
+				}
+
+				if prev, pending := files[event.Name]; pending {
+					unchanged = unchanged && prev
 				}
 
-				debounce = 500 * time.Millisecond
-				files[event.Name] = true
+				files[event.Name] = unchanged
+				timer.Reset(debounce)
 
-			case _, ok := <-watcher.Errors:
+			case err, ok := <-watcher.Errors:
 				if !ok {
 					return
 				}
 
+				log.Warnf("watcher error: %s", err)
+
 				// prevent high cpu usage on endless loop
-				time.Sleep(250 * time.Millisecond)
+				<-w.clock.After(250 * time.Millisecond)
 			}
 
 		}
 	}()
 }
 
+// unchanged hashes the file and reports if the content is the same as on
+// the last call.
+func (w *Watcher) unchanged(hash map[string][]byte, file string) bool {
+
+	hasher, err := blake2b.New256(nil)
+	if err != nil {
+		return false
+	}
+
+	f, err := os.OpenFile(file, os.O_RDONLY, 0)
+	if err != nil {
+		delete(hash, file)
+		return false
+	}
+
+	defer f.Close()
+
+	if _, err = io.Copy(hasher, f); err != nil {
+		return false
+	}
+
+	crc := hasher.Sum(nil)
+
+	if oldHash, exist := hash[file]; exist && bytes.Equal(crc, oldHash) {
+		return true
+	}
+
+	hash[file] = crc
+
+	return false
+}
+
 func (w *Watcher) Stop() {
 
 	if w.Watcher == nil || !w.running.IsSet() {
@@ -2,7 +2,9 @@ package srv
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/hex"
 	"errors"
 	"io/ioutil"
 	"net/http"
@@ -12,8 +14,14 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/kernelschmelze/pkg/clock"
+	"github.com/kernelschmelze/pkg/logger"
 )
 
+// RequestIDHeader is the header used to pass the request id.
+const RequestIDHeader = "X-Request-Id"
+
 var (
 	ErrAlreadyExist = errors.New("already exist")
 	ErrDoesNotExist = errors.New("does not exist")
@@ -33,6 +41,7 @@ type onShutdown func(addr string, err error)
 
 type Srv struct {
 	handler map[string]*http.Server
+	clock   clock.Clock
 	mu      sync.RWMutex
 	wg      sync.WaitGroup
 
@@ -43,11 +52,23 @@ type Srv struct {
 func New(onListen onListen, onShutdown onShutdown) *Srv {
 	return &Srv{
 		handler:      make(map[string]*http.Server),
+		clock:        clock.System,
 		cbOnListen:   onListen,
 		cbOnShutdown: onShutdown,
 	}
 }
 
+// SetClock sets the clock of the shutdown timeout, it has to be called
+// before a server is added.
+func (s *Srv) SetClock(c clock.Clock) {
+
+	if c == nil {
+		c = clock.System
+	}
+
+	s.clock = c
+}
+
 func (s *Srv) Add(config Config) error {
 
 	addr := config.Addr
@@ -79,7 +100,8 @@ func (s *Srv) Add(config Config) error {
 	}
 
 	server := &http.Server{
-		Addr: addr,
+		Addr:     addr,
+		ErrorLog: logger.NewStdLogger("srv", logger.ErrorLevel),
 	}
 
 	if certificate, err := tlsCertificate(config.CrtFile, config.KeyFile); err == nil && certificate != nil {
@@ -97,10 +119,13 @@ func (s *Srv) Add(config Config) error {
 		return err
 	}
 
-	if config.Handler != nil {
-		server.Handler = config.Handler
+	handler := config.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
 	}
 
+	server.Handler = requestContext(handler)
+
 	s.mu.Lock()
 	s.handler[addr] = server
 	s.mu.Unlock()
@@ -178,7 +203,19 @@ func (s *Srv) shutdown(server *http.Server) {
 		return
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), 2*time.Second)
+	timeout := s.clock.After(2 * time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-timeout:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
 	server.Shutdown(ctx)
 
 }
@@ -199,6 +236,34 @@ func (s *Srv) onShutdown(addr string, err error) {
 
 }
 
+// requestContext attaches the request id to the request context, an id
+// sent by the client in the X-Request-Id header is reused.
+func requestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		id := r.Header.Get(RequestIDHeader)
+		if len(id) == 0 || len(id) > 128 {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+
+		ctx := logger.WithContext(r.Context(), logger.RequestID(id))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+
+	var b [8]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
 func tlsCertificate(crtFile string, keyFile string) (*tls.Certificate, error) {
 
 	if len(crtFile) == 0 && len(keyFile) == 0 {